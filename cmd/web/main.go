@@ -5,7 +5,10 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	"formy.fprzg.net/internal/types"
 	"formy.fprzg.net/internal/utils"
@@ -17,13 +20,62 @@ func main() {
 	var cfg types.AppConfig
 	flag.StringVar(&cfg.Port, "port", ":3000", "API server port.")
 	flag.StringVar(&cfg.Env, "env", "development", "Environment (testing | development | staging | production)")
+	flag.StringVar(&cfg.BaseURL, "base-url", "http://localhost:3000", "Public URL of the app, used in the links of the emails sent.")
 
 	flag.StringVar(&cfg.DBDir, "db-dir", "./app.db", "Database directory.")
 
 	flag.StringVar(&cfg.JWTSecret, "jwt-secret", "some-secret-key", "JWT secret key.")
 
-	// rate-limiter config
-	// smtp server config
+	flag.Func("time-layouts", "Comma-separated Go time layouts used to parse submitted dates (default: RFC 3339 and HTML date inputs).", func(s string) error {
+		cfg.TimeLayouts = strings.Split(s, ",")
+		return nil
+	})
+
+	cfg.RateLimits = types.RateLimitConfig{
+		PerIP:     types.RateLimit{PerMinute: 30, Burst: 10},
+		PerForm:   types.RateLimit{PerMinute: 120, Burst: 60},
+		PerIPForm: types.RateLimit{PerMinute: 6, Burst: 3},
+	}
+	rateLimitFlag := func(name, usage string, rl *types.RateLimit) {
+		flag.Func(name, fmt.Sprintf("%s, as <per minute>:<burst>; 0 disables it (default %s).", usage, rl), func(s string) error {
+			parsed, err := types.ParseRateLimit(s)
+			*rl = parsed
+			return err
+		})
+	}
+	rateLimitFlag("rate-limit-ip", "Submissions allowed per client IP", &cfg.RateLimits.PerIP)
+	rateLimitFlag("rate-limit-form", "Submissions allowed per form", &cfg.RateLimits.PerForm)
+	rateLimitFlag("rate-limit-ip-form", "Submissions allowed per client IP on each form", &cfg.RateLimits.PerIPForm)
+	flag.DurationVar(&cfg.RateLimits.IdleTimeout, "rate-limit-idle", 10*time.Minute, "How long idle rate limit buckets are kept.")
+
+	flag.Func("trusted-proxies", "Comma-separated IPs or CIDRs of the proxies allowed to set X-Forwarded-For.", func(s string) error {
+		for _, proxy := range strings.Split(s, ",") {
+			proxy = strings.TrimSpace(proxy)
+			if !strings.Contains(proxy, "/") {
+				if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+					proxy += "/32"
+				} else {
+					proxy += "/128"
+				}
+			}
+
+			_, network, err := net.ParseCIDR(proxy)
+			if err != nil {
+				return err
+			}
+			cfg.TrustedProxies = append(cfg.TrustedProxies, network)
+		}
+		return nil
+	})
+
+	flag.StringVar(&cfg.Mail.SMTPHost, "smtp-host", "", "SMTP server host. Emails are written to -mail-dir when it's empty.")
+	flag.IntVar(&cfg.Mail.SMTPPort, "smtp-port", 587, "SMTP server port.")
+	flag.StringVar(&cfg.Mail.SMTPUsername, "smtp-username", "", "SMTP username.")
+	flag.StringVar(&cfg.Mail.SMTPPassword, "smtp-password", "", "SMTP password.")
+	flag.StringVar(&cfg.Mail.Sender, "mail-sender", "Formy <no-reply@formy.fprzg.net>", "From address of the emails sent.")
+	flag.StringVar(&cfg.Mail.Dir, "mail-dir", "", "Directory emails are written to when there's no SMTP server; they are only logged if it's empty.")
+
+	flag.IntVar(&cfg.JobWorkers, "job-workers", 2, "Number of background job workers.")
 
 	flag.Parse()
 
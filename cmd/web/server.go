@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,7 +15,6 @@ import (
 	"formy.fprzg.net/internal/models"
 	"formy.fprzg.net/internal/services"
 	"formy.fprzg.net/internal/types"
-	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -50,19 +50,11 @@ func NewServer(cfg types.AppConfig, db *sql.DB) (Server, error) {
 	}
 
 	e := echo.New()
+	e.IPExtractor = ipExtractor(cfg.TrustedProxies)
 
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 
-	jwtConfig := echojwt.Config{
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return new(services.JWTCustomClaims)
-		},
-		SigningKey:   []byte(cfg.JWTSecret),
-		TokenLookup:  "cookie:jwt",
-		ErrorHandler: errorHandler,
-	}
-
 	tm, err := services.NewTemplateManager(cfg.Env == "development", e)
 	if err != nil {
 		return Server{}, err
@@ -73,11 +65,21 @@ func NewServer(cfg types.AppConfig, db *sql.DB) (Server, error) {
 		return Server{}, err
 	}
 
-	s, err := services.Get(cfg.JWTSecret, m, tm, e)
+	s, err := services.Get(cfg, m, tm, e)
 	if err != nil {
 		return Server{}, err
 	}
 
+	// Access tokens are checked against the token version of their user, so
+	// revoked sessions stop working before the tokens expire.
+	jwtConfig := echojwt.Config{
+		ParseTokenFunc: func(c echo.Context, auth string) (interface{}, error) {
+			return s.AuthenticateAccessToken(auth)
+		},
+		TokenLookup:  "cookie:jwt",
+		ErrorHandler: errorHandler,
+	}
+
 	c, err := controllers.Get(m, s, e, jwtConfig)
 	if err != nil {
 		return Server{}, err
@@ -102,14 +104,46 @@ func errorHandler(c echo.Context, err error) error {
 	return c.Redirect(http.StatusSeeOther, "/users/login")
 }
 
+// ipExtractor reads the client IP from X-Forwarded-For only for requests
+// coming from one of the trusted proxies, skipping the addresses they added.
+func ipExtractor(trusted []*net.IPNet) echo.IPExtractor {
+	if len(trusted) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, network := range trusted {
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// Shutdown stops accepting requests, waits for the ones in flight and then
+// drains the job workers. Jobs not started yet run on the next start. Every
+// step runs even if an earlier one fails; the first error is returned.
 func (srv *Server) Shutdown(ctx context.Context) error {
-	return nil
+	err := srv.e.Shutdown(ctx)
+
+	if jobsErr := srv.s.Jobs.Shutdown(ctx); err == nil {
+		err = jobsErr
+	}
+	srv.s.Close()
+
+	return err
 }
 
 func (srv *Server) Serve() error {
 	shutdownError := make(chan error)
 	go srv.HandleSignals(shutdownError)
 
+	if err := srv.s.Jobs.Start(); err != nil {
+		return err
+	}
+
 	srv.e.Logger.Info("starting server", map[string]string{
 		"port": srv.Port,
 		"env":  srv.Env,
@@ -148,13 +182,13 @@ func (srv *Server) HandleSignals(shutdownError chan error) {
 	err := srv.Shutdown(ctx)
 	if err != nil {
 		shutdownError <- err
+		return
 	}
 
 	srv.e.Logger.Info("completing background tasks", map[string]string{
 		"port": srv.Port,
 	})
 
-	//app.wg.Wait()
 	shutdownError <- nil
 }
 
@@ -1,11 +1,15 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"formy.fprzg.net/internal/models"
 	"formy.fprzg.net/internal/services"
+	"formy.fprzg.net/internal/types"
+	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 )
@@ -17,20 +21,51 @@ type Controllers struct {
 	JWTConfig echojwt.Config
 	public    *echo.Group
 	protected *echo.Group
+	// api is the protected /api group, which also takes API keys.
+	api *echo.Group
 }
 
 const StaticFilesDir = "../../public"
 
+const (
+	accessTokenCookie  = "jwt"
+	refreshTokenCookie = "refresh_token"
+)
+
 func Get(m *models.Models, s *services.Services, e *echo.Echo, jwtConfig echojwt.Config) (*Controllers, error) {
 	c := &Controllers{
 		models:    m,
 		services:  s,
 		e:         e,
 		JWTConfig: jwtConfig,
-		protected: e.Group("", echojwt.WithConfig(jwtConfig)),
 		public:    e.Group(""),
 	}
 
+	// Expired access tokens are renewed on the fly with the refresh token,
+	// so browsers stay logged in for as long as their session lasts.
+	onError := jwtConfig.ErrorHandler
+	jwtConfig.ContinueOnIgnoredError = true
+	jwtConfig.ErrorHandler = func(ctx echo.Context, err error) error {
+		if c.refreshSession(ctx) == nil {
+			return nil
+		}
+		if strings.HasPrefix(ctx.Request().URL.Path, "/api/") {
+			if handlerErr := apiError(ctx, http.StatusUnauthorized, "authentication required"); handlerErr != nil {
+				return handlerErr
+			}
+		} else if onError != nil {
+			if handlerErr := onError(ctx, err); handlerErr != nil {
+				return handlerErr
+			}
+		}
+		// Returning nil would run the handler without a user, even after
+		// the request was answered.
+		return echo.ErrUnauthorized.WithInternal(err)
+	}
+	session := echojwt.WithConfig(jwtConfig)
+	c.protected = e.Group("", session)
+	c.api = e.Group("/api", c.authenticateAPI(session))
+
 	c.staticFiles()
 	c.apiRoutes()
 	c.frontendRoutes()
@@ -39,17 +74,21 @@ func Get(m *models.Models, s *services.Services, e *echo.Echo, jwtConfig echojwt
 }
 
 func (ct *Controllers) render(c echo.Context, templateName string, td any) error {
+	return ct.renderStatus(c, http.StatusOK, templateName, td)
+}
+
+func (ct *Controllers) renderStatus(c echo.Context, status int, templateName string, td any) error {
 	html, err := ct.services.TemplateManager.ExecuteTemplate(templateName, td)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.HTML(http.StatusOK, html)
+	return c.HTML(status, html)
 }
 
-func (ct *Controllers) setCookie(c echo.Context, value string, expirationDate time.Time) {
+func (ct *Controllers) setCookie(c echo.Context, name, value string, expirationDate time.Time) {
 	cookie := new(http.Cookie)
-	cookie.Name = "jwt"
+	cookie.Name = name
 	cookie.Value = value
 	cookie.Path = "/"
 	cookie.HttpOnly = true
@@ -59,6 +98,74 @@ func (ct *Controllers) setCookie(c echo.Context, value string, expirationDate ti
 	c.SetCookie(cookie)
 }
 
+func (ct *Controllers) setSessionCookies(c echo.Context, session services.Session) {
+	ct.setCookie(c, accessTokenCookie, session.Access.Token, session.Access.ExpiresAt)
+	ct.setCookie(c, refreshTokenCookie, session.Refresh.Token, session.Refresh.ExpiresAt)
+}
+
+func (ct *Controllers) clearSessionCookies(c echo.Context) {
+	ct.setCookie(c, accessTokenCookie, "", time.Unix(0, 0))
+	ct.setCookie(c, refreshTokenCookie, "", time.Unix(0, 0))
+}
+
+// refreshSession rotates the refresh token cookie of c and stores the new
+// access token where the protected group would have.
+func (ct *Controllers) refreshSession(c echo.Context) error {
+	cookie, err := c.Cookie(refreshTokenCookie)
+	if err != nil {
+		return err
+	}
+
+	session, err := ct.services.RefreshSession(cookie.Value)
+	if err != nil {
+		ct.clearSessionCookies(c)
+		return err
+	}
+
+	token, err := ct.services.ParseAccessToken(session.Access.Token)
+	if err != nil {
+		return err
+	}
+
+	ct.setSessionCookies(c, session)
+	c.Set("user", token)
+	return nil
+}
+
+// userClaims returns the claims of the JWT validated by the protected group.
+func userClaims(c echo.Context) *services.JWTCustomClaims {
+	user := c.Get("user").(*jwt.Token)
+	return user.Claims.(*services.JWTCustomClaims)
+}
+
+// fieldErrorMessages returns the first error of every field, to show next
+// to it.
+func fieldErrorMessages(errs types.ValidationErrors) map[string]string {
+	messages := make(map[string]string)
+	for _, fe := range errs {
+		if _, ok := messages[fe.Field]; !ok {
+			messages[fe.Field] = fe.Message
+		}
+	}
+	return messages
+}
+
+// successRedirect returns where browsers are sent after submitting form: the
+// redirect configured for the form or its thank-you page.
+func successRedirect(form types.FormData) string {
+	if form.Settings.SuccessRedirect != "" {
+		return form.Settings.SuccessRedirect
+	}
+	return fmt.Sprintf("/f/%d/thanks", form.ID)
+}
+
+// acceptsHTML reports whether the client prefers an HTML response, which is
+// the case for browsers posting a plain <form>.
+func acceptsHTML(r *http.Request) bool {
+	accept := r.Header.Get(echo.HeaderAccept)
+	return strings.Contains(accept, echo.MIMETextHTML) && !strings.HasPrefix(accept, echo.MIMEApplicationJSON)
+}
+
 //
 //
 // ROUTES
@@ -72,10 +179,34 @@ func (c *Controllers) staticFiles() {
 
 func (c *Controllers) apiRoutes() {
 	pub := c.public.Group("/api")
-	pub.POST("/submissions/new/:id", c.handlerSubmissionsNewPost)
-
-	prot := c.protected.Group("/api")
+	pub.GET("/forms/:id", c.handlerFormsGet)
+	pub.GET("/forms/:id/token", c.handlerFormsTokenGet)
+	pub.POST("/submissions/new/:id", c.handlerSubmissionsNewPost, c.rateLimitSubmissions)
+
+	formsRead := requireScope(types.ScopeFormsRead)
+	formsWrite := requireScope(types.ScopeFormsWrite)
+	// Webhooks carry submissions, and their secrets sign them, so managing
+	// them also takes submissions:read.
+	webhooksRead := requireScope(types.ScopeFormsRead, types.ScopeSubmissionsRead)
+	webhooksWrite := requireScope(types.ScopeFormsWrite, types.ScopeSubmissionsRead)
+
+	prot := c.api
 	prot.GET("/ping", c.handlerPingGet)
+	prot.GET("/files/:id", c.handlerFilesGet, requireScope(types.ScopeSubmissionsRead))
+	prot.DELETE("/submissions/:id", c.handlerSubmissionsDelete, requireScope(types.ScopeSubmissionsDelete))
+	prot.GET("/forms/:id/webhooks", c.handlerWebhooksGet, webhooksRead)
+	prot.POST("/forms/:id/webhooks", c.handlerWebhooksPost, webhooksWrite)
+	prot.DELETE("/webhooks/:id", c.handlerWebhooksDelete, formsWrite)
+	prot.GET("/webhooks/:id/deliveries", c.handlerWebhookDeliveriesGet, webhooksRead)
+	prot.POST("/webhooks/:id/test", c.handlerWebhookTestPost, webhooksWrite)
+	prot.POST("/deliveries/:id/redeliver", c.handlerDeliveryRedeliverPost, webhooksWrite)
+
+	v1 := prot.Group("/v1", apiErrors)
+	v1.GET("/forms", c.handlerV1FormsGet, formsRead)
+	v1.POST("/forms", c.handlerV1FormsPost, formsWrite)
+	v1.GET("/forms/:id", c.handlerV1FormGet, formsRead)
+	v1.PATCH("/forms/:id", c.handlerV1FormPatch, formsWrite)
+	v1.DELETE("/forms/:id", c.handlerV1FormDelete, formsWrite)
 }
 func (c *Controllers) frontendRoutes() {
 	pub := c.public.Group("")
@@ -84,10 +215,35 @@ func (c *Controllers) frontendRoutes() {
 	pub.POST("/users/register", c.handlerUsersRegisterPost)
 	pub.GET("/users/login", c.handlerUsersLoginGet)
 	pub.POST("/users/login", c.handlerUsersLoginPost)
+	pub.GET("/users/verify", c.handlerUsersVerifyGet)
+	pub.GET("/users/verify/resend", c.handlerUsersVerifyResendGet)
+	pub.POST("/users/verify/resend", c.handlerUsersVerifyResendPost)
+	pub.GET("/users/password/forgot", c.handlerUsersPasswordForgotGet)
+	pub.POST("/users/password/forgot", c.handlerUsersPasswordForgotPost)
+	pub.GET("/users/password/reset", c.handlerUsersPasswordResetGet)
+	pub.POST("/users/password/reset", c.handlerUsersPasswordResetPost)
+	pub.POST("/users/refresh", c.handlerUsersRefreshPost)
+	pub.GET("/users/logout", c.handlerUsersLogout)
+	pub.POST("/users/logout", c.handlerUsersLogout)
+	pub.GET("/f/:id", c.handlerPublicFormGet)
+	pub.POST("/f/:id", c.handlerPublicFormPost, c.rateLimitSubmissions)
+	pub.GET("/f/:id/thanks", c.handlerPublicFormThanksGet)
 
 	prot := c.protected.Group("")
-	prot.GET("/users/logout", c.handlerUsersLogout)
-	prot.POST("/users/logout", c.handlerUsersLogout)
+	prot.POST("/users/logout/all", c.handlerUsersLogoutAllPost)
 	prot.GET("/dash", c.handlerDashboardGet)
+	prot.GET("/dash/spam", c.handlerSpamGet)
+	prot.POST("/dash/spam/:id/accept", c.handlerSpamAcceptPost)
+	prot.POST("/dash/spam/:id/delete", c.handlerSpamDeletePost)
+	prot.GET("/dash/incidents", c.handlerIncidentsGet)
+	prot.GET("/dash/webhooks", c.handlerDashWebhooksGet)
+	prot.POST("/dash/webhooks", c.handlerDashWebhooksPost)
+	prot.GET("/dash/webhooks/:id", c.handlerDashWebhookGet)
+	prot.POST("/dash/webhooks/:id/delete", c.handlerDashWebhookDeletePost)
+	prot.POST("/dash/webhooks/:id/test", c.handlerDashWebhookTestPost)
+	prot.POST("/dash/deliveries/:id/redeliver", c.handlerDashRedeliverPost)
+	prot.GET("/dash/api-keys", c.handlerDashAPIKeysGet)
+	prot.POST("/dash/api-keys", c.handlerDashAPIKeysPost)
+	prot.POST("/dash/api-keys/:id/delete", c.handlerDashAPIKeyDeletePost)
 	prot.POST("/form/create", c.handlerFormsCreatePost)
 }
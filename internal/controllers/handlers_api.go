@@ -1,9 +1,16 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
 	"github.com/labstack/echo/v4"
 )
 
@@ -13,6 +20,58 @@ func (c *Controllers) handlerPingGet(ctx echo.Context) error {
 	})
 }
 
+// handlerFormsGet returns the public definition of a form, which is all an
+// embed script needs to render it.
+func (c *Controllers) handlerFormsGet(ctx echo.Context) error {
+	formID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	form, err := c.models.Forms.Get(formID)
+	if err != nil {
+		if errors.Is(err, models.ErrFormNotFound) {
+			return ctx.JSON(http.StatusNotFound, echo.Map{"message": "form not found"})
+		}
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"id":           form.ID,
+		"name":         form.Name,
+		"description":  form.Description,
+		"form_version": form.FormVersion,
+		"fields":       form.Fields,
+	})
+}
+
+// handlerFormsTokenGet hands out render tokens to forms that aren't rendered
+// by formy, which have to send it back in the _formy_token field.
+func (c *Controllers) handlerFormsTokenGet(ctx echo.Context) error {
+	formID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := c.models.Forms.Get(formID); err != nil {
+		if errors.Is(err, models.ErrFormNotFound) {
+			return ctx.JSON(http.StatusNotFound, echo.Map{"message": "form not found"})
+		}
+		return err
+	}
+
+	token, err := c.services.NewRenderToken(formID)
+	if err != nil {
+		return err
+	}
+
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"field_name": types.RenderTokenField,
+		"token":      token,
+	})
+}
+
 func (c *Controllers) handlerSubmissionsNewPost(ctx echo.Context) error {
 	formID, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
@@ -22,7 +81,34 @@ func (c *Controllers) handlerSubmissionsNewPost(ctx echo.Context) error {
 	r := ctx.Request()
 	submissionID, err := c.services.ProcessSubmission(formID, r, r.Context())
 	if err != nil {
-		return ctx.String(http.StatusBadRequest, err.Error())
+		status := http.StatusBadRequest
+		body := echo.Map{"message": err.Error()}
+
+		var fieldErrors types.ValidationErrors
+		if errors.As(err, &fieldErrors) {
+			status = http.StatusUnprocessableEntity
+			body = echo.Map{
+				"message": "validation failed",
+				"errors":  fieldErrors,
+			}
+		} else if errors.Is(err, types.ErrUnsupportedMediaType) {
+			status = http.StatusUnsupportedMediaType
+		} else if errors.Is(err, types.ErrRequestTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		if acceptsHTML(r) {
+			return ctx.String(status, err.Error())
+		}
+		return ctx.JSON(status, body)
+	}
+
+	if acceptsHTML(r) {
+		form, err := c.models.Forms.Get(formID)
+		if err != nil {
+			return err
+		}
+		return ctx.Redirect(http.StatusSeeOther, successRedirect(form))
 	}
 
 	return ctx.JSON(http.StatusOK, echo.Map{
@@ -30,3 +116,317 @@ func (c *Controllers) handlerSubmissionsNewPost(ctx echo.Context) error {
 		"submission_id": submissionID,
 	})
 }
+
+func (c *Controllers) handlerFilesGet(ctx echo.Context) error {
+	fileID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	file, f, err := c.services.OpenSubmissionFile(userClaims(ctx).UserID, fileID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return ctx.JSON(http.StatusNotFound, echo.Map{"message": "file not found"})
+		}
+		return err
+	}
+	defer f.Close()
+
+	header := ctx.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": file.FileName}))
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+
+	return ctx.Stream(http.StatusOK, file.MimeType, f)
+}
+
+func (c *Controllers) handlerSubmissionsDelete(ctx echo.Context) error {
+	submissionID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.models.Submissions.Delete(userClaims(ctx).UserID, submissionID); err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return ctx.JSON(http.StatusNotFound, echo.Map{"message": "submission not found"})
+		}
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (c *Controllers) handlerWebhooksGet(ctx echo.Context) error {
+	formID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	form, err := c.models.Forms.Get(formID)
+	if err != nil && !errors.Is(err, models.ErrFormNotFound) {
+		return err
+	}
+	if err != nil || form.UserID != userClaims(ctx).UserID {
+		return ctx.JSON(http.StatusNotFound, echo.Map{"message": "form not found"})
+	}
+
+	webhooks, err := c.models.Webhooks.GetByFormID(formID)
+	if err != nil {
+		return err
+	}
+	if webhooks == nil {
+		webhooks = []types.Webhook{}
+	}
+
+	return ctx.JSON(http.StatusOK, echo.Map{"webhooks": webhooks})
+}
+
+func (c *Controllers) handlerWebhooksPost(ctx echo.Context) error {
+	formID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	var body struct {
+		URL string `json:"url" form:"url"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		return err
+	}
+
+	webhook, err := c.services.CreateWebhook(userClaims(ctx).UserID, formID, body.URL)
+	if err != nil {
+		var fieldErrors types.ValidationErrors
+		if errors.As(err, &fieldErrors) {
+			return ctx.JSON(http.StatusUnprocessableEntity, echo.Map{
+				"message": "validation failed",
+				"errors":  fieldErrors,
+			})
+		}
+		if errors.Is(err, models.ErrFormNotFound) {
+			return ctx.JSON(http.StatusNotFound, echo.Map{"message": "form not found"})
+		}
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, webhook)
+}
+
+func (c *Controllers) handlerWebhooksDelete(ctx echo.Context) error {
+	webhookID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.models.Webhooks.Delete(userClaims(ctx).UserID, webhookID); err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return ctx.JSON(http.StatusNotFound, echo.Map{"message": "webhook not found"})
+		}
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (c *Controllers) handlerWebhookDeliveriesGet(ctx echo.Context) error {
+	webhookID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	userID := userClaims(ctx).UserID
+	if _, err := c.models.Webhooks.Get(userID, webhookID); err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return ctx.JSON(http.StatusNotFound, echo.Map{"message": "webhook not found"})
+		}
+		return err
+	}
+
+	deliveries, err := c.models.Webhooks.GetDeliveries(userID, webhookID)
+	if err != nil {
+		return err
+	}
+	if deliveries == nil {
+		deliveries = []types.WebhookDelivery{}
+	}
+
+	return ctx.JSON(http.StatusOK, echo.Map{"deliveries": deliveries})
+}
+
+// handlerWebhookTestPost queues a test event to the webhook. Its outcome
+// shows up in the deliveries.
+func (c *Controllers) handlerWebhookTestPost(ctx echo.Context) error {
+	webhookID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	deliveryID, err := c.services.SendTestEvent(userClaims(ctx).UserID, webhookID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return ctx.JSON(http.StatusNotFound, echo.Map{"message": "webhook not found"})
+		}
+		return err
+	}
+
+	return ctx.JSON(http.StatusAccepted, echo.Map{"delivery_id": deliveryID})
+}
+
+func (c *Controllers) handlerDeliveryRedeliverPost(ctx echo.Context) error {
+	deliveryID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, err.Error())
+	}
+
+	newID, err := c.services.Redeliver(userClaims(ctx).UserID, deliveryID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return ctx.JSON(http.StatusNotFound, echo.Map{"message": "delivery not found"})
+		}
+		return err
+	}
+
+	return ctx.JSON(http.StatusAccepted, echo.Map{"delivery_id": newID})
+}
+
+// ///////////////////////////////////////////////
+//
+// # API V1
+//
+// ///////////////////////////////////////////////
+
+// apiErrorBody is the envelope of every error answered by /api/v1. Code is
+// the status text in snake case, e.g. "not_found".
+type apiErrorBody struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Errors  types.ValidationErrors `json:"errors,omitempty"`
+}
+
+func apiError(ctx echo.Context, status int, message string, errs ...types.FieldError) error {
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	return ctx.JSON(status, apiErrorBody{Code: code, Message: message, Errors: errs})
+}
+
+// apiErrors answers the errors returned by /api/v1 handlers with the error
+// envelope, instead of echo's default body.
+func apiErrors(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		err := next(ctx)
+		if err == nil || ctx.Response().Committed {
+			return err
+		}
+
+		var fieldErrors types.ValidationErrors
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &fieldErrors):
+			return apiError(ctx, http.StatusUnprocessableEntity, "validation failed", fieldErrors...)
+		case errors.Is(err, models.ErrFormNotFound):
+			return apiError(ctx, http.StatusNotFound, "form not found")
+		case errors.Is(err, models.ErrInvalidInput):
+			return apiError(ctx, http.StatusUnprocessableEntity, "invalid input")
+		case errors.As(err, &httpErr):
+			return apiError(ctx, httpErr.Code, fmt.Sprint(httpErr.Message))
+		}
+
+		ctx.Logger().Error(err)
+		return apiError(ctx, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// formID reads the :id parameter of the /api/v1/forms routes.
+func formID(ctx echo.Context) (int, error) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "invalid form id")
+	}
+	return id, nil
+}
+
+// formBody is what /api/v1/forms takes to create a form.
+type formBody struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Fields      []types.FormField  `json:"fields"`
+	Settings    types.FormSettings `json:"settings"`
+}
+
+func (c *Controllers) handlerV1FormsGet(ctx echo.Context) error {
+	forms, err := c.models.Forms.GetFormsByUserID(userClaims(ctx).UserID)
+	if err != nil {
+		return err
+	}
+	if forms == nil {
+		forms = []types.FormData{}
+	}
+
+	return ctx.JSON(http.StatusOK, echo.Map{"forms": forms})
+}
+
+func (c *Controllers) handlerV1FormGet(ctx echo.Context) error {
+	id, err := formID(ctx)
+	if err != nil {
+		return err
+	}
+
+	form, err := c.services.UserForm(userClaims(ctx).UserID, id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, form)
+}
+
+func (c *Controllers) handlerV1FormsPost(ctx echo.Context) error {
+	var body formBody
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid JSON body")
+	}
+
+	form, err := c.services.CreateForm(userClaims(ctx).UserID, types.FormData{
+		Name:        body.Name,
+		Description: body.Description,
+		Fields:      body.Fields,
+		Settings:    body.Settings,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/api/v1/forms/%d", form.ID))
+	return ctx.JSON(http.StatusCreated, form)
+}
+
+// handlerV1FormPatch updates the members sent of a form. Sending fields adds a
+// new version of the form.
+func (c *Controllers) handlerV1FormPatch(ctx echo.Context) error {
+	id, err := formID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var patch types.FormPatch
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&patch); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid JSON body")
+	}
+
+	form, err := c.services.PatchForm(userClaims(ctx).UserID, id, patch)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, form)
+}
+
+func (c *Controllers) handlerV1FormDelete(ctx echo.Context) error {
+	id, err := formID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.models.Forms.DeleteForm(userClaims(ctx).UserID, id); err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
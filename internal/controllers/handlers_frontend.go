@@ -1,12 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"time"
+	"strconv"
 
+	"formy.fprzg.net/internal/models"
 	"formy.fprzg.net/internal/services"
-	"github.com/golang-jwt/jwt/v5"
+	"formy.fprzg.net/internal/types"
 	"github.com/labstack/echo/v4"
 )
 
@@ -16,7 +18,26 @@ import (
 //
 // ///////////////////////////////////////////////
 func (ct *Controllers) handlerUsersRegisterPost(c echo.Context) error {
-	return nil
+	err := ct.services.RegisterUser(c)
+	if err != nil {
+		var fieldErrors types.ValidationErrors
+		if !errors.As(err, &fieldErrors) {
+			return err
+		}
+
+		td := services.NewTemplateData(c.Request())
+		td.FieldErrors = fieldErrorMessages(fieldErrors)
+		td.FieldValues = map[string]string{
+			"user_name": c.FormValue("user_name"),
+			"email":     c.FormValue("email"),
+		}
+		return ct.renderStatus(c, http.StatusUnprocessableEntity, "users-register.tmpl.html", td)
+	}
+
+	td := services.NewTemplateData(c.Request())
+	td.Flash = "Te enviamos un correo con el enlace para activar tu cuenta."
+	td.FieldValues = map[string]string{"email": c.FormValue("email")}
+	return ct.render(c, "users-verify.tmpl.html", td)
 }
 
 func (ct *Controllers) handlerUsersRegisterGet(c echo.Context) error {
@@ -25,13 +46,17 @@ func (ct *Controllers) handlerUsersRegisterGet(c echo.Context) error {
 }
 
 func (ct *Controllers) handlerUsersLoginPost(c echo.Context) error {
-	token, err := ct.services.UserLogin(c)
+	session, err := ct.services.UserLogin(c)
 	if err != nil {
+		if errors.Is(err, models.ErrInactiveAccount) {
+			td := services.NewTemplateData(c.Request())
+			td.Flash = "Tu cuenta aún no está activada. Abre el enlace que te enviamos por correo o pide uno nuevo."
+			return ct.renderStatus(c, http.StatusForbidden, "users-verify.tmpl.html", td)
+		}
 		return c.String(http.StatusBadRequest, err.Error())
 	}
 
-	expirationDate := time.Now().Add(time.Hour * 6).Unix()
-	ct.setCookie(c, token, time.Unix(expirationDate, 0))
+	ct.setSessionCookies(c, session)
 
 	return c.Redirect(http.StatusSeeOther, "/dash")
 }
@@ -41,12 +66,151 @@ func (ct *Controllers) handlerUsersLoginGet(c echo.Context) error {
 	return ct.render(c, "users-login.tmpl.html", td)
 }
 
+func (ct *Controllers) handlerUsersVerifyGet(c echo.Context) error {
+	err := ct.services.VerifyEmail(c.QueryParam("token"))
+	if err != nil {
+		td := services.NewTemplateData(c.Request())
+		switch {
+		case errors.Is(err, services.ErrExpiredVerificationToken):
+			td.Flash = "El enlace de activación venció. Pide uno nuevo."
+		case errors.Is(err, services.ErrInvalidVerificationToken):
+			td.Flash = "El enlace de activación no es válido. Pide uno nuevo."
+		default:
+			return err
+		}
+		return ct.renderStatus(c, http.StatusBadRequest, "users-verify.tmpl.html", td)
+	}
+
+	td := services.NewTemplateData(c.Request())
+	td.Flash = "Tu cuenta fue activada. Ya puedes iniciar sesión."
+	return ct.render(c, "users-login.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerUsersVerifyResendGet(c echo.Context) error {
+	td := services.NewTemplateData(c.Request())
+	return ct.render(c, "users-verify.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerUsersVerifyResendPost(c echo.Context) error {
+	if err := ct.services.ResendVerification(c.FormValue("email")); err != nil {
+		return err
+	}
+
+	td := services.NewTemplateData(c.Request())
+	td.Flash = "Si hay una cuenta sin activar con ese correo, le enviamos un nuevo enlace."
+	td.FieldValues = map[string]string{"email": c.FormValue("email")}
+	return ct.render(c, "users-verify.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerUsersPasswordForgotGet(c echo.Context) error {
+	td := services.NewTemplateData(c.Request())
+	return ct.render(c, "users-password-forgot.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerUsersPasswordForgotPost(c echo.Context) error {
+	if err := ct.services.RequestPasswordReset(c.FormValue("login")); err != nil {
+		return err
+	}
+
+	td := services.NewTemplateData(c.Request())
+	td.Flash = "Si encontramos tu cuenta, te enviamos un correo con un enlace para cambiar tu contraseña."
+	return ct.render(c, "users-password-forgot.tmpl.html", td)
+}
+
+// renderInvalidPasswordReset sends users with a bad reset link back to ask
+// for a new one.
+func (ct *Controllers) renderInvalidPasswordReset(c echo.Context) error {
+	td := services.NewTemplateData(c.Request())
+	td.Flash = "El enlace para cambiar tu contraseña no es válido o ya venció. Pide uno nuevo."
+	return ct.renderStatus(c, http.StatusBadRequest, "users-password-forgot.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerUsersPasswordResetGet(c echo.Context) error {
+	token := c.QueryParam("token")
+	if _, err := ct.services.PasswordResetUser(token); err != nil {
+		if errors.Is(err, services.ErrInvalidPasswordResetToken) {
+			return ct.renderInvalidPasswordReset(c)
+		}
+		return err
+	}
+
+	td := services.NewTemplateData(c.Request())
+	td.FieldValues = map[string]string{"token": token}
+	return ct.render(c, "users-password-reset.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerUsersPasswordResetPost(c echo.Context) error {
+	token := c.FormValue("token")
+	err := ct.services.ResetPassword(token, c.FormValue("password"), c.FormValue("password_confirmation"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPasswordResetToken) {
+			return ct.renderInvalidPasswordReset(c)
+		}
+
+		var fieldErrors types.ValidationErrors
+		if !errors.As(err, &fieldErrors) {
+			return err
+		}
+
+		td := services.NewTemplateData(c.Request())
+		td.FieldErrors = map[string]string{fieldErrors[0].Field: fieldErrors[0].Message}
+		td.FieldValues = map[string]string{"token": token}
+		return ct.renderStatus(c, http.StatusUnprocessableEntity, "users-password-reset.tmpl.html", td)
+	}
+
+	td := services.NewTemplateData(c.Request())
+	td.Flash = "Tu contraseña fue cambiada. Ya puedes iniciar sesión."
+	return ct.render(c, "users-login.tmpl.html", td)
+}
+
+// handlerUsersRefreshPost rotates the refresh token cookie, for clients that
+// renew their access token before it expires.
+func (ct *Controllers) handlerUsersRefreshPost(c echo.Context) error {
+	cookie, err := c.Cookie(refreshTokenCookie)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "missing refresh token"})
+	}
+
+	session, err := ct.services.RefreshSession(cookie.Value)
+	if err != nil {
+		ct.clearSessionCookies(c)
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, models.ErrTokenReuse) {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"message": "invalid refresh token"})
+		}
+		return err
+	}
+
+	ct.setSessionCookies(c, session)
+	return c.JSON(http.StatusOK, echo.Map{
+		"access_token": session.Access.Token,
+		"expires_at":   session.Access.ExpiresAt,
+	})
+}
+
 func (ct *Controllers) handlerUsersLogout(c echo.Context) error {
-	ct.setCookie(c, "", time.Unix(0, 0))
+	if cookie, err := c.Cookie(refreshTokenCookie); err == nil {
+		if err := ct.services.Logout(cookie.Value); err != nil {
+			return err
+		}
+	}
+	ct.clearSessionCookies(c)
 
 	return c.Redirect(http.StatusSeeOther, "/users/login")
 }
 
+// handlerUsersLogoutAllPost ends the sessions of the user on every device,
+// including this one.
+func (ct *Controllers) handlerUsersLogoutAllPost(c echo.Context) error {
+	if err := ct.services.SignOutEverywhere(userClaims(c).UserID); err != nil {
+		return err
+	}
+	ct.clearSessionCookies(c)
+
+	td := services.NewTemplateData(c.Request())
+	td.Flash = "Cerraste sesión en todos tus dispositivos."
+	return ct.render(c, "users-login.tmpl.html", td)
+}
+
 // ///////////////////////////////////////////////
 //
 // # FRONTEND HANDLERS
@@ -60,9 +224,7 @@ func (ct *Controllers) handlerHomePageGet(c echo.Context) error {
 func (ct *Controllers) handlerDashboardGet(c echo.Context) error {
 	td := services.NewTemplateData(c.Request())
 
-	user := c.Get("user").(*jwt.Token)
-	claims := user.Claims.(*services.JWTCustomClaims)
-	userData, err := ct.models.Users.Get(claims.UserID)
+	userData, err := ct.models.Users.Get(userClaims(c).UserID)
 	if err != nil {
 		return err
 	}
@@ -73,6 +235,288 @@ func (ct *Controllers) handlerDashboardGet(c echo.Context) error {
 	return ct.render(c, "dash.tmpl.html", td)
 }
 
+func (ct *Controllers) handlerSpamGet(c echo.Context) error {
+	td := services.NewTemplateData(c.Request())
+
+	spam, err := ct.models.Submissions.GetByStatus(userClaims(c).UserID, types.SubmissionStatusSpam)
+	if err != nil {
+		return err
+	}
+
+	td.SubmissionsData = map[string]any{"Spam": spam}
+	td.Dashboard = true
+	return ct.render(c, "dash-spam.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerSpamAcceptPost(c echo.Context) error {
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+
+	err = ct.models.Submissions.SetStatus(userClaims(c).UserID, submissionID, types.SubmissionStatusAccepted)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/dash/spam")
+}
+
+func (ct *Controllers) handlerSpamDeletePost(c echo.Context) error {
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+
+	err = ct.models.Submissions.Delete(userClaims(c).UserID, submissionID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/dash/spam")
+}
+
+// incidentGroup holds the incidents of one form for the incidents page.
+type incidentGroup struct {
+	FormID    int
+	FormName  string
+	Incidents []types.Incident
+}
+
+func (ct *Controllers) handlerIncidentsGet(c echo.Context) error {
+	td := services.NewTemplateData(c.Request())
+
+	incidents, err := ct.models.Incidents.GetByUserID(userClaims(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	// Incidents come ordered by form.
+	var groups []incidentGroup
+	for _, incident := range incidents {
+		if len(groups) == 0 || groups[len(groups)-1].FormID != incident.FormID {
+			groups = append(groups, incidentGroup{FormID: incident.FormID, FormName: incident.FormName})
+		}
+		last := &groups[len(groups)-1]
+		last.Incidents = append(last.Incidents, incident)
+	}
+
+	td.SubmissionsData = map[string]any{"Incidents": groups}
+	td.Dashboard = true
+	return ct.render(c, "dash-incidents.tmpl.html", td)
+}
+
+// webhookGroup holds a form and its webhooks for the webhooks page.
+type webhookGroup struct {
+	FormID   int
+	FormName string
+	Webhooks []types.Webhook
+}
+
+func (ct *Controllers) handlerDashWebhooksGet(c echo.Context) error {
+	td := services.NewTemplateData(c.Request())
+	userID := userClaims(c).UserID
+
+	forms, err := ct.models.Forms.GetFormsByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := ct.models.Webhooks.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	groups := make([]webhookGroup, 0, len(forms))
+	for _, form := range forms {
+		group := webhookGroup{FormID: form.ID, FormName: form.Name}
+		for _, webhook := range webhooks {
+			if webhook.FormID == form.ID {
+				group.Webhooks = append(group.Webhooks, webhook)
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	td.FormsData = map[string]any{"Webhooks": groups}
+	td.Dashboard = true
+	return ct.render(c, "dash-webhooks.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerDashWebhooksPost(c echo.Context) error {
+	formID, err := strconv.Atoi(c.FormValue("form_id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "invalid form_id")
+	}
+
+	_, err = ct.services.CreateWebhook(userClaims(c).UserID, formID, c.FormValue("url"))
+	if err != nil {
+		var fieldErrors types.ValidationErrors
+		if errors.As(err, &fieldErrors) {
+			return c.String(http.StatusUnprocessableEntity, fieldErrors.Error())
+		}
+		if errors.Is(err, models.ErrFormNotFound) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/dash/webhooks")
+}
+
+func (ct *Controllers) handlerDashWebhookGet(c echo.Context) error {
+	webhookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+
+	userID := userClaims(c).UserID
+	webhook, err := ct.models.Webhooks.Get(userID, webhookID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+
+	deliveries, err := ct.models.Webhooks.GetDeliveries(userID, webhookID)
+	if err != nil {
+		return err
+	}
+
+	td := services.NewTemplateData(c.Request())
+	td.FormsData = map[string]any{"Webhook": webhook, "Deliveries": deliveries}
+	td.Dashboard = true
+	return ct.render(c, "dash-webhook.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerDashWebhookDeletePost(c echo.Context) error {
+	webhookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+
+	err = ct.models.Webhooks.Delete(userClaims(c).UserID, webhookID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/dash/webhooks")
+}
+
+func (ct *Controllers) handlerDashWebhookTestPost(c echo.Context) error {
+	webhookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+
+	_, err = ct.services.SendTestEvent(userClaims(c).UserID, webhookID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/dash/webhooks/%d", webhookID))
+}
+
+func (ct *Controllers) handlerDashRedeliverPost(c echo.Context) error {
+	deliveryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+
+	userID := userClaims(c).UserID
+	newID, err := ct.services.Redeliver(userID, deliveryID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+
+	delivery, _, err := ct.models.Webhooks.GetDelivery(newID)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/dash/webhooks/%d", delivery.WebhookID))
+}
+
+// renderAPIKeys renders the API keys page. newKey is the key just created,
+// which can't be shown again.
+func (ct *Controllers) renderAPIKeys(c echo.Context, status int, td *services.TemplateData, newKey string) error {
+	keys, err := ct.models.APIKeys.GetByUserID(userClaims(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	td.FormsData = map[string]any{"APIKeys": keys, "Scopes": types.APIKeyScopes, "NewKey": newKey}
+	td.Dashboard = true
+	return ct.renderStatus(c, status, "dash-api-keys.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerDashAPIKeysGet(c echo.Context) error {
+	return ct.renderAPIKeys(c, http.StatusOK, services.NewTemplateData(c.Request()), "")
+}
+
+func (ct *Controllers) handlerDashAPIKeysPost(c echo.Context) error {
+	form, err := c.FormParams()
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	req := types.NewAPIKey{Name: form.Get("name"), Scopes: form["scopes"]}
+	if days := form.Get("expires_in_days"); days != "" {
+		if req.ExpiresInDays, err = strconv.Atoi(days); err != nil {
+			req.ExpiresInDays = -1
+		}
+	}
+
+	td := services.NewTemplateData(c.Request())
+	key, _, err := ct.services.CreateAPIKey(userClaims(c).UserID, req)
+	if err != nil {
+		var fieldErrors types.ValidationErrors
+		if !errors.As(err, &fieldErrors) {
+			return err
+		}
+
+		td.FieldErrors = fieldErrorMessages(fieldErrors)
+		td.FieldValues = map[string]string{"name": req.Name}
+		return ct.renderAPIKeys(c, http.StatusUnprocessableEntity, td, "")
+	}
+
+	td.Flash = "Copia la clave ahora, no se volverá a mostrar."
+	return ct.renderAPIKeys(c, http.StatusCreated, td, key)
+}
+
+func (ct *Controllers) handlerDashAPIKeyDeletePost(c echo.Context) error {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+
+	err = ct.models.APIKeys.Delete(userClaims(c).UserID, keyID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/dash/api-keys")
+}
+
 // ///////////////////////////////////////////////
 //
 // # FORM HANDLERS
@@ -80,14 +524,104 @@ func (ct *Controllers) handlerDashboardGet(c echo.Context) error {
 // ///////////////////////////////////////////////
 func (ct *Controllers) handlerFormsCreatePost(c echo.Context) error {
 	r := c.Request()
-	formID, err := ct.services.ProcessForm(r, r.Context())
+	formID, err := ct.services.ProcessForm(userClaims(c).UserID, r)
 	if err != nil {
+		var fieldErrors types.ValidationErrors
+		if errors.As(err, &fieldErrors) {
+			return c.JSON(http.StatusUnprocessableEntity, echo.Map{
+				"message": "invalid form definition",
+				"errors":  fieldErrors,
+			})
+		}
 		return c.String(http.StatusBadRequest, err.Error())
 	}
 
 	return c.String(http.StatusOK, fmt.Sprintf("%d", formID))
 }
 
-func (ct *Controllers) formGetHandle(c echo.Context) error {
-	return nil
+// ///////////////////////////////////////////////
+//
+// # PUBLIC FORM HANDLERS
+//
+// ///////////////////////////////////////////////
+
+// DefaultSuccessMessage is shown on the thank-you page of forms that don't
+// configure their own.
+const DefaultSuccessMessage = "¡Gracias! Tu respuesta ha sido enviada."
+
+func (ct *Controllers) publicForm(c echo.Context) (types.FormData, error) {
+	formID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return types.FormData{}, echo.ErrNotFound
+	}
+
+	form, err := ct.models.Forms.Get(formID)
+	if err != nil {
+		if errors.Is(err, models.ErrFormNotFound) {
+			return types.FormData{}, echo.ErrNotFound
+		}
+		return types.FormData{}, err
+	}
+
+	return form, nil
+}
+
+func (ct *Controllers) handlerPublicFormGet(c echo.Context) error {
+	form, err := ct.publicForm(c)
+	if err != nil {
+		return err
+	}
+
+	td := services.NewTemplateData(c.Request())
+	view := ct.services.NewFormView(form, nil, nil)
+	td.PublicForm = &view
+	return ct.render(c, "forms-public.tmpl.html", td)
+}
+
+func (ct *Controllers) handlerPublicFormPost(c echo.Context) error {
+	form, err := ct.publicForm(c)
+	if err != nil {
+		return err
+	}
+
+	r := c.Request()
+	_, err = ct.services.ProcessSubmission(form.ID, r, r.Context())
+	if err != nil {
+		var fieldErrors types.ValidationErrors
+		if !errors.As(err, &fieldErrors) {
+			if errors.Is(err, types.ErrUnsupportedMediaType) {
+				return c.String(http.StatusUnsupportedMediaType, err.Error())
+			}
+			if errors.Is(err, types.ErrRequestTooLarge) {
+				return c.String(http.StatusRequestEntityTooLarge, err.Error())
+			}
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+
+		// The body was already parsed while processing the submission, so
+		// this only collects the values to fill the form again.
+		values, _ := types.SubmissionValuesFromRequest(r, services.MaxSubmissionMemory)
+
+		td := services.NewTemplateData(r)
+		view := ct.services.NewFormView(form, values, fieldErrors)
+		td.PublicForm = &view
+		return ct.renderStatus(c, http.StatusUnprocessableEntity, "forms-public.tmpl.html", td)
+	}
+
+	return c.Redirect(http.StatusSeeOther, successRedirect(form))
+}
+
+func (ct *Controllers) handlerPublicFormThanksGet(c echo.Context) error {
+	form, err := ct.publicForm(c)
+	if err != nil {
+		return err
+	}
+
+	td := services.NewTemplateData(c.Request())
+	td.PublicForm = &services.FormView{ID: form.ID, Name: form.Name}
+	td.SuccessMessage = form.Settings.SuccessMessage
+	if td.SuccessMessage == "" {
+		td.SuccessMessage = DefaultSuccessMessage
+	}
+	return ct.render(c, "forms-thanks.tmpl.html", td)
 }
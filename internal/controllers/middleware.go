@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"formy.fprzg.net/internal/services"
+	"formy.fprzg.net/internal/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// apiKeyContextKey is where authenticateAPI stores the key of a request.
+const apiKeyContextKey = "api_key"
+
+// authenticateAPI lets the API be called with an API key sent as a bearer
+// token. Requests without one go through session, the cookie JWT check.
+func (c *Controllers) authenticateAPI(session echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withSession := session(next)
+
+		return func(ctx echo.Context) error {
+			key, ok := strings.CutPrefix(ctx.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok {
+				return withSession(ctx)
+			}
+
+			apiKey, err := c.services.AuthenticateAPIKey(strings.TrimSpace(key))
+			if err != nil {
+				if errors.Is(err, services.ErrInvalidAPIKey) {
+					ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+					return apiError(ctx, http.StatusUnauthorized, "invalid API key")
+				}
+				return err
+			}
+
+			// Handlers find the user of the request in the claims, like
+			// with a session.
+			ctx.Set(apiKeyContextKey, apiKey)
+			ctx.Set("user", &jwt.Token{
+				Claims: &services.JWTCustomClaims{UserID: apiKey.UserID},
+				Valid:  true,
+			})
+			return next(ctx)
+		}
+	}
+}
+
+// requireScope rejects requests made with an API key that doesn't grant
+// every one of scopes. Sessions opened by logging in can do anything.
+func requireScope(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			apiKey, ok := ctx.Get(apiKeyContextKey).(types.APIKey)
+			if !ok {
+				return next(ctx)
+			}
+			for _, scope := range scopes {
+				if !apiKey.HasScope(scope) {
+					return apiError(ctx, http.StatusForbidden, "API key lacks the "+scope+" scope")
+				}
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// rateLimitSubmissions throttles submissions per client IP, per form and per
+// client IP on each form, answering 429 with Retry-After once a limit is hit.
+func (c *Controllers) rateLimitSubmissions(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		formID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return next(ctx)
+		}
+
+		retryAfter, err := c.services.CheckSubmissionRate(ctx.RealIP(), formID)
+		if err != nil {
+			return err
+		}
+		if retryAfter <= 0 {
+			return next(ctx)
+		}
+
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		ctx.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds))
+
+		if acceptsHTML(ctx.Request()) {
+			return ctx.String(http.StatusTooManyRequests, fmt.Sprintf("Too many submissions, try again in %d seconds.", seconds))
+		}
+		return ctx.JSON(http.StatusTooManyRequests, echo.Map{
+			"message":     "too many requests",
+			"retry_after": seconds,
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"formy.fprzg.net/internal/types"
+	"github.com/labstack/echo/v4"
+)
+
+type APIKeysModelInterface interface {
+	Insert(userID int, name, prefix, keyHash string, scopes []string, expiresAt time.Time) (int, error)
+	GetByUserID(userID int) ([]types.APIKey, error)
+	Authenticate(keyHash string) (types.APIKey, error)
+	Delete(userID, keyID int) error
+}
+
+// APIKeysModel stores the hashes of the keys users call the API with.
+type APIKeysModel struct {
+	db *sql.DB
+	e  *echo.Echo
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, scopes, COALESCE(expires_at, ''), COALESCE(last_used_at, ''), created_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (types.APIKey, error) {
+	var k types.APIKey
+	var scopes string
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &scopes, &k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt)
+	k.Scopes = types.ParseScopes(scopes)
+	return k, err
+}
+
+// Insert stores a key. Keys with a zero expiresAt don't expire.
+func (m *APIKeysModel) Insert(userID int, name, prefix, keyHash string, scopes []string, expiresAt time.Time) (int, error) {
+	const stmt = `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	var expires sql.NullString
+	if !expiresAt.IsZero() {
+		expires = sql.NullString{String: expiresAt.UTC().Format(sqliteTimeLayout), Valid: true}
+	}
+
+	result, err := m.db.Exec(stmt, userID, name, prefix, keyHash, strings.Join(scopes, " "), expires)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (m *APIKeysModel) GetByUserID(userID int) ([]types.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE user_id = ?
+		ORDER BY id
+	`
+
+	rows, err := m.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []types.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// Authenticate returns the key with keyHash and records that it was used. It
+// returns ErrNoRecord if there's no such key or it expired.
+func (m *APIKeysModel) Authenticate(keyHash string) (types.APIKey, error) {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = ?
+		WHERE key_hash = ? AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		RETURNING ` + apiKeyColumns
+
+	now := time.Now().UTC().Format(sqliteTimeLayout)
+	k, err := scanAPIKey(m.db.QueryRow(query, now, keyHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.APIKey{}, ErrNoRecord
+		}
+		return types.APIKey{}, err
+	}
+
+	return k, nil
+}
+
+func (m *APIKeysModel) Delete(userID, keyID int) error {
+	const stmt = `DELETE FROM api_keys WHERE id = ? AND user_id = ?`
+
+	result, err := m.db.Exec(stmt, keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -27,15 +29,17 @@ type FormInstance struct {
 }
 
 type FormsModelInterface interface {
-	Insert(userID int, name, description string, fields []types.FormField) (int, error)
+	Insert(userID int, name, description string, fields []types.FormField, settings types.FormSettings) (int, error)
 	Get(formID int) (types.FormData, error)
 	GetFormsByUserID(userID int) ([]types.FormData, error)
 	GetFormInstances(userID int) ([]types.FormData, error)
 	GetFormInstanceID(formID int) (int, error)
-	//UpdateName(formID int, name string) error
-	//UpdateDescription(formID int, description string) error
-	//UpdateFields(formID int, fields []types.FieldDescriptor) (int, error)
-	//DeleteForm(formID int) error
+	Update(userID, formID int, patch types.FormPatch) (int, error)
+	UpdateName(userID, formID int, name string) error
+	UpdateDescription(userID, formID int, description string) error
+	UpdateSettings(userID, formID int, settings types.FormSettings) error
+	UpdateFields(userID, formID int, fields []types.FormField) (int, error)
+	DeleteForm(userID, formID int) error
 }
 
 type FormsModel struct {
@@ -43,10 +47,10 @@ type FormsModel struct {
 	e  *echo.Echo
 }
 
-func (m *FormsModel) Insert(userID int, name, description string, fields []types.FormField) (int, error) {
+func (m *FormsModel) Insert(userID int, name, description string, fields []types.FormField, settings types.FormSettings) (int, error) {
 	const stmtForm = `
-        INSERT INTO forms (user_id, name, description)
-        VALUES (?, ?, ?)
+        INSERT INTO forms (user_id, name, description, settings)
+        VALUES (?, ?, ?, ?)
         RETURNING id, created_at, updated_at, form_version
     `
 
@@ -67,13 +71,25 @@ func (m *FormsModel) Insert(userID int, name, description string, fields []types
 		return 0, fmt.Errorf("models: form has to have at least one field")
 	}
 
+	if err := types.ValidateFormFields(fields); err != nil {
+		return 0, err
+	}
+	if err := types.ValidateFormSettings(settings, fields); err != nil {
+		return 0, err
+	}
+
 	fieldsJSON, err := utils.ToJSON(fields)
 	if err != nil {
 		return 0, err
 	}
 
+	settingsJSON, err := utils.ToJSON(settings)
+	if err != nil {
+		return 0, err
+	}
+
 	var f types.FormData
-	err = m.db.QueryRow(stmtForm, userID, name, description).Scan(&f.ID, &f.CreatedAt, &f.UpdatedAt, &f.FormVersion)
+	err = m.db.QueryRow(stmtForm, userID, name, description, settingsJSON).Scan(&f.ID, &f.CreatedAt, &f.UpdatedAt, &f.FormVersion)
 	if err != nil {
 		if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
 			return 0, ErrInvalidUserID
@@ -87,12 +103,12 @@ func (m *FormsModel) Insert(userID int, name, description string, fields []types
 		return 0, err
 	}
 
-	return fi.ID, nil
+	return f.ID, nil
 }
 
 func (m *FormsModel) Get(formID int) (types.FormData, error) {
 	const queryGetForm = `
-        SELECT user_id, id, name, description, created_at, updated_at
+        SELECT user_id, id, name, description, created_at, updated_at, settings
         FROM forms
         WHERE id = ?
     `
@@ -106,9 +122,18 @@ func (m *FormsModel) Get(formID int) (types.FormData, error) {
 	`
 
 	var f types.FormData
-	err := m.db.QueryRow(queryGetForm, formID).Scan(&f.UserID, &f.ID, &f.Name, &f.Description, &f.CreatedAt, &f.UpdatedAt)
-	if err == sql.ErrNoRows {
-		return types.FormData{}, ErrFormNotFound
+	var settingsJSON string
+	err := m.db.QueryRow(queryGetForm, formID).Scan(&f.UserID, &f.ID, &f.Name, &f.Description, &f.CreatedAt, &f.UpdatedAt, &settingsJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.FormData{}, ErrFormNotFound
+		}
+		return types.FormData{}, err
+	}
+
+	err = json.Unmarshal([]byte(settingsJSON), &f.Settings)
+	if err != nil {
+		return types.FormData{}, err
 	}
 
 	var fi FormInstance
@@ -121,6 +146,7 @@ func (m *FormsModel) Get(formID int) (types.FormData, error) {
 	if err != nil {
 		return types.FormData{}, err
 	}
+	f.FormVersion = fi.FormVersion
 
 	return f, err
 }
@@ -128,13 +154,13 @@ func (m *FormsModel) Get(formID int) (types.FormData, error) {
 func (m *FormsModel) GetFormsByUserID(userID int) ([]types.FormData, error) {
 	const query = `
     SELECT
-		f.id, f.name, f.description, f.created_at, f.updated_at,
+		f.id, f.name, f.description, f.created_at, f.updated_at, f.settings,
 		fi.form_version, fi.fields
 	FROM forms f
 	LEFT JOIN form_instances fi ON fi.id = (
 		SELECT id FROM form_instances
 		WHERE form_id = f.id
-		ORDER BY created_at DESC
+		ORDER BY id DESC
 		LIMIT 1
 	)
 	WHERE f.user_id = ?
@@ -148,15 +174,20 @@ func (m *FormsModel) GetFormsByUserID(userID int) ([]types.FormData, error) {
 
 	var forms []types.FormData
 	for rows.Next() {
-		var f types.FormData
-		var formFields string
+		f := types.FormData{UserID: userID}
+		var formFields, settingsJSON string
 		err = rows.Scan(
-			&f.ID, &f.Name, &f.Description, &f.CreatedAt, &f.UpdatedAt,
+			&f.ID, &f.Name, &f.Description, &f.CreatedAt, &f.UpdatedAt, &settingsJSON,
 			&f.FormVersion, &formFields)
 		if err != nil {
 			return nil, err
 		}
 
+		err = json.Unmarshal([]byte(settingsJSON), &f.Settings)
+		if err != nil {
+			return nil, err
+		}
+
 		err = json.Unmarshal([]byte(formFields), &f.Fields)
 		if err != nil {
 			return nil, err
@@ -229,98 +260,211 @@ func (m *FormsModel) GetFormInstances(formID int) ([]types.FormData, error) {
 	return instances, nil
 }
 
+// GetFormInstanceID returns the ID of the latest instance of a form, the one
+// new submissions are stored against.
 func (m *FormsModel) GetFormInstanceID(formID int) (int, error) {
 	const query = `
 		SELECT id
 		FROM form_instances
-		WHERE id = ?
-		ORDER BY form_id DESC
+		WHERE form_id = ?
+		ORDER BY id DESC
 		LIMIT 1
 	`
 
 	var formInstanceID int
 	err := m.db.QueryRow(query, formID).Scan(&formInstanceID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrFormNotFound
+		}
 		return 0, err
 	}
 
 	return formInstanceID, nil
 }
 
-/*
-func (m *FormsModel) UpdateName(formID int, name string) error {
-	const stmt = `
-	UPDATE forms
-	SET name = ?, updated_at = CURRENT_TIMESTAMP
-	WHERE id = ?
+// Update applies patch to a form of the user in one go, so fields and the
+// settings that refer to them can change together. New fields are stored as
+// a new instance; submissions keep pointing to the one they were made with.
+// It returns the form version after the update.
+func (m *FormsModel) Update(userID, formID int, patch types.FormPatch) (int, error) {
+	const queryForm = `
+	SELECT settings
+	FROM forms
+	WHERE id = ? AND user_id = ?
 	`
 
-	rows, err := utils.ExecuteSqlStmt(m.db, stmt, name, formID)
-	if rows == 0 {
-		return ErrFormNotFound
-	}
-
-	return err
-}
-
-func (m *FormsModel) UpdateDescription(formID int, description string) error {
-	const query = `
-	UPDATE forms
-	SET description = ?, updated_at = CURRENT_TIMESTAMP
-	WHERE id = ?
+	const queryInstance = `
+	SELECT form_version, fields
+	FROM form_instances
+	WHERE form_id = ?
+	ORDER BY id DESC
+	LIMIT 1
 	`
 
-	rows, err := utils.ExecuteSqlStmt(m.db, query, description, formID)
-	if rows == 0 {
-		return ErrFormNotFound
-	}
-
-	return err
-}
-
-func (m *FormsModel) UpdateFields(formID int, fields []types.FieldDescriptor) (int, error) {
-	const xx = `
-	SELECT form_version
-	FROM forms
+	const stmtForm = `
+	UPDATE forms
+	SET name = COALESCE(?, name),
+		description = COALESCE(?, description),
+		settings = COALESCE(?, settings),
+		updated_at = CURRENT_TIMESTAMP
 	WHERE id = ?
 	`
 
-	const stmt = `
+	const stmtInstance = `
 	INSERT INTO form_instances (form_id, fields, form_version)
 	VALUES (?, ?, ?)
-	RETURNING id, created_at
 	`
 
-	fieldsString, err := utils.ToJSON(fields)
+	if patch.Name != nil && *patch.Name == "" {
+		return 0, ErrInvalidInput
+	}
+	if patch.Fields != nil && len(patch.Fields) == 0 {
+		return 0, ErrInvalidInput
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	var formVersion int
-	err = m.db.QueryRow(xx, formID).Scan(&formVersion)
+	var settingsJSON string
+	err = tx.QueryRowContext(ctx, queryForm, formID, userID).Scan(&settingsJSON)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrFormNotFound
+		}
 		return 0, err
 	}
 
-	var f types.FormData
-	err = m.db.QueryRow(stmt, formID, fieldsString, formVersion+1).Scan(&f.ID, &f.CreatedAt)
-	if err != nil {
+	var formVersion int
+	var fieldsJSON string
+	if err = tx.QueryRowContext(ctx, queryInstance, formID).Scan(&formVersion, &fieldsJSON); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrFormNotFound
+		}
+		return 0, err
+	}
+
+	fields := patch.Fields
+	if fields == nil {
+		if err = json.Unmarshal([]byte(fieldsJSON), &fields); err != nil {
+			return 0, err
+		}
+	} else if err = types.ValidateFormFields(fields); err != nil {
 		return 0, err
 	}
 
-	return formVersion + 1, nil
+	var settings types.FormSettings
+	if patch.Settings != nil {
+		settings = *patch.Settings
+	} else if err = json.Unmarshal([]byte(settingsJSON), &settings); err != nil {
+		return 0, err
+	}
+	if err = types.ValidateFormSettings(settings, fields); err != nil {
+		return 0, err
+	}
+
+	var newSettings any
+	if patch.Settings != nil {
+		if newSettings, err = utils.ToJSON(settings); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, stmtForm, patch.Name, patch.Description, newSettings, formID); err != nil {
+		return 0, err
+	}
+
+	if patch.Fields != nil {
+		newFields, err := utils.ToJSON(fields)
+		if err != nil {
+			return 0, err
+		}
+
+		formVersion++
+		if _, err = tx.ExecContext(ctx, stmtInstance, formID, newFields, formVersion); err != nil {
+			return 0, err
+		}
+	}
+
+	return formVersion, tx.Commit()
 }
 
-func (m *FormsModel) DeleteForm(formID int) error {
-	const stmt = `
-	DELETE FROM forms WHERE id = ?
+func (m *FormsModel) UpdateName(userID, formID int, name string) error {
+	_, err := m.Update(userID, formID, types.FormPatch{Name: &name})
+	return err
+}
+
+func (m *FormsModel) UpdateDescription(userID, formID int, description string) error {
+	_, err := m.Update(userID, formID, types.FormPatch{Description: &description})
+	return err
+}
+
+func (m *FormsModel) UpdateSettings(userID, formID int, settings types.FormSettings) error {
+	_, err := m.Update(userID, formID, types.FormPatch{Settings: &settings})
+	return err
+}
+
+// UpdateFields stores fields as a new instance of the form and returns its
+// version.
+func (m *FormsModel) UpdateFields(userID, formID int, fields []types.FormField) (int, error) {
+	return m.Update(userID, formID, types.FormPatch{Fields: fields})
+}
+
+// DeleteForm removes a form of the user with its instances, submissions,
+// webhooks and incidents. Like SubmissionsModel.Delete, children are deleted
+// explicitly since foreign keys may not be enforced on every connection.
+func (m *FormsModel) DeleteForm(userID, formID int) error {
+	const stmtOwned = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM forms
+			WHERE id = ? AND user_id = ?
+		)
 	`
 
-	rows, err := utils.ExecuteSqlStmt(m.db, stmt, formID)
-	if rows == 0 {
+	const submissions = `SELECT id FROM submissions WHERE form_id = ?`
+	stmts := []string{
+		`DELETE FROM submission_fields WHERE submission_id IN (` + submissions + `)`,
+		`DELETE FROM unique_submission_fields WHERE submission_id IN (` + submissions + `)`,
+		`DELETE FROM submission_files WHERE submission_id IN (` + submissions + `)`,
+		`DELETE FROM submission_unexpected_fields WHERE submission_id IN (` + submissions + `)`,
+		`DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE form_id = ?)`,
+		`DELETE FROM webhooks WHERE form_id = ?`,
+		`DELETE FROM incidents WHERE form_id = ?`,
+		`DELETE FROM used_form_tokens WHERE form_id = ?`,
+		`DELETE FROM submissions WHERE form_id = ?`,
+		`DELETE FROM form_instances WHERE form_id = ?`,
+		`DELETE FROM forms WHERE id = ?`,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owned bool
+	if err = tx.QueryRowContext(ctx, stmtOwned, formID, userID).Scan(&owned); err != nil {
+		return err
+	}
+	if !owned {
 		return ErrFormNotFound
 	}
 
-	return err
+	for _, stmt := range stmts {
+		if _, err = tx.ExecContext(ctx, stmt, formID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
-*/
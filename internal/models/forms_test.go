@@ -73,7 +73,7 @@ func TestFormsInsert(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.TestName, func(t *testing.T) {
-			_, err := m.Forms.Insert(tt.userID, tt.name, tt.description, tt.fields)
+			_, err := m.Forms.Insert(tt.userID, tt.name, tt.description, tt.fields, types.FormSettings{})
 			if tt.expectedError == nil {
 				assert.NoError(t, err)
 			} else {
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"formy.fprzg.net/internal/types"
+	"github.com/labstack/echo/v4"
+)
+
+type IncidentsModelInterface interface {
+	Insert(incident types.Incident) (int, error)
+	GetByUserID(userID int) ([]types.Incident, error)
+}
+
+// IncidentsModel stores the incidents reported to form owners. Incidents of
+// stored submissions are inserted by SubmissionsModel.Insert, in the same
+// transaction as the submission.
+type IncidentsModel struct {
+	db *sql.DB
+	e  *echo.Echo
+}
+
+// incidentDetails is the JSON kept in incidents.details.
+type incidentDetails struct {
+	Fields []string `json:"fields"`
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertIncident(ctx context.Context, db execer, incident types.Incident) (int, error) {
+	const stmt = `
+		INSERT INTO incidents (form_id, submission_id, kind, policy, details)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	details, err := json.Marshal(incidentDetails{Fields: incident.Fields})
+	if err != nil {
+		return 0, err
+	}
+
+	var submissionID sql.NullInt64
+	if incident.SubmissionID != 0 {
+		submissionID = sql.NullInt64{Int64: int64(incident.SubmissionID), Valid: true}
+	}
+
+	result, err := db.ExecContext(ctx, stmt, incident.FormID, submissionID, incident.Kind, incident.Policy, string(details))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (m *IncidentsModel) Insert(incident types.Incident) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	id, err := insertIncident(ctx, m.db, incident)
+	if err != nil {
+		m.e.Logger.Printf("Insert: failed to insert incident for form %d: '%v'.\n", incident.FormID, err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetByUserID returns the incidents of the user's forms, grouped by form and
+// newest first within each one.
+func (m *IncidentsModel) GetByUserID(userID int) ([]types.Incident, error) {
+	const query = `
+		SELECT i.id, i.form_id, f.name, i.submission_id, i.kind, i.policy, i.details, i.created_at
+		FROM incidents i
+		JOIN forms f ON f.id = i.form_id
+		WHERE f.user_id = ?
+		ORDER BY i.form_id, i.id DESC
+	`
+
+	rows, err := m.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var incidents []types.Incident
+	for rows.Next() {
+		var incident types.Incident
+		var submissionID sql.NullInt64
+		var details string
+
+		err = rows.Scan(&incident.ID, &incident.FormID, &incident.FormName, &submissionID, &incident.Kind, &incident.Policy, &details, &incident.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		var d incidentDetails
+		if err = json.Unmarshal([]byte(details), &d); err != nil {
+			return nil, err
+		}
+		incident.Fields = d.Fields
+		incident.SubmissionID = int(submissionID.Int64)
+
+		incidents = append(incidents, incident)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return incidents, nil
+}
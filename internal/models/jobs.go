@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"formy.fprzg.net/internal/types"
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultJobMaxAttempts is how many times a job runs before it's dead.
+const DefaultJobMaxAttempts = 5
+
+type JobsModelInterface interface {
+	Enqueue(kind string, payload any) (int, error)
+	Claim() (types.Job, error)
+	Complete(jobID int) error
+	Retry(jobID int, runAt time.Time, lastError string) error
+	Bury(jobID int, lastError string) error
+	RequeueRunning() (int, error)
+	GetByStatus(status string) ([]types.Job, error)
+}
+
+// JobsModel is the storage of the background job queue. Jobs about a
+// submission are enqueued by SubmissionsModel.Insert, in the same
+// transaction as the submission.
+type JobsModel struct {
+	db *sql.DB
+	e  *echo.Echo
+}
+
+func insertJob(ctx context.Context, db execer, kind string, payload any) (int, error) {
+	const stmt = `
+		INSERT INTO jobs (kind, payload, max_attempts)
+		VALUES (?, ?, ?)
+	`
+
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := db.ExecContext(ctx, stmt, kind, string(buf), DefaultJobMaxAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (m *JobsModel) Enqueue(kind string, payload any) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	id, err := insertJob(ctx, m.db, kind, payload)
+	if err != nil {
+		m.e.Logger.Printf("Enqueue: failed to enqueue %s job: '%v'.\n", kind, err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// Claim marks the next due job as running and returns it, with its attempts
+// already counting this run. It returns ErrNoRecord when no job is due.
+func (m *JobsModel) Claim() (types.Job, error) {
+	// A single statement, so two workers can't claim the same job.
+	const stmt = `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id
+			FROM jobs
+			WHERE status = 'pending' AND run_at <= CURRENT_TIMESTAMP
+			ORDER BY run_at, id
+			LIMIT 1
+		)
+		RETURNING id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at
+	`
+
+	var job types.Job
+	var payload string
+	err := m.db.QueryRow(stmt).Scan(&job.ID, &job.Kind, &payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LastError, &job.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.Job{}, ErrNoRecord
+		}
+		return types.Job{}, err
+	}
+	job.Payload = json.RawMessage(payload)
+
+	return job, nil
+}
+
+// Complete removes a job that ran successfully.
+func (m *JobsModel) Complete(jobID int) error {
+	const stmt = `DELETE FROM jobs WHERE id = ?`
+
+	_, err := m.db.Exec(stmt, jobID)
+	return err
+}
+
+// Retry puts a failed job back in the queue to run again at runAt.
+func (m *JobsModel) Retry(jobID int, runAt time.Time, lastError string) error {
+	const stmt = `
+		UPDATE jobs
+		SET status = 'pending', run_at = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := m.db.Exec(stmt, runAt.UTC().Format(sqliteTimeLayout), lastError, jobID)
+	return err
+}
+
+// Bury moves a job to the dead letters.
+func (m *JobsModel) Bury(jobID int, lastError string) error {
+	const stmt = `
+		UPDATE jobs
+		SET status = 'dead', last_error = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := m.db.Exec(stmt, lastError, jobID)
+	return err
+}
+
+// RequeueRunning puts back in the queue the jobs left running by a process
+// that stopped before finishing them. It must only be called while no
+// worker is running.
+func (m *JobsModel) RequeueRunning() (int, error) {
+	const stmt = `
+		UPDATE jobs
+		SET status = 'pending', updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'running'
+	`
+
+	result, err := m.db.Exec(stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
+
+// GetByStatus returns the jobs with status, oldest first.
+func (m *JobsModel) GetByStatus(status string) ([]types.Job, error) {
+	const query = `
+		SELECT id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at
+		FROM jobs
+		WHERE status = ?
+		ORDER BY id
+	`
+
+	rows, err := m.db.Query(query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []types.Job
+	for rows.Next() {
+		var job types.Job
+		var payload string
+		err = rows.Scan(&job.ID, &job.Kind, &payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LastError, &job.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		job.Payload = json.RawMessage(payload)
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
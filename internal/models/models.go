@@ -12,7 +12,9 @@ import (
 var (
 	ErrNoRecord           = errors.New("models: no matching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
+	ErrInactiveAccount    = errors.New("models: account not activated")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	ErrDuplicateUserName  = errors.New("models: duplicate user name")
 	ErrInvalidInput       = errors.New("models: invalid input")
 	ErrInvalidUserID      = errors.New("models: user not found")
 	ErrUserNotFound       = errors.New("models: user not found")
@@ -21,6 +23,7 @@ var (
 
 const (
 	ValidUserName     = "alice"
+	ValidUserEmail    = "alice@example.com"
 	ValidUserPassword = "securepass"
 )
 
@@ -28,6 +31,12 @@ type Models struct {
 	Users           UsersModelInterface
 	Forms           FormsModelInterface
 	Submissions     SubmissionsModelInterface
+	Incidents       IncidentsModelInterface
+	Jobs            JobsModelInterface
+	Webhooks        WebhooksModelInterface
+	PasswordResets  PasswordResetsModelInterface
+	RefreshTokens   RefreshTokensModelInterface
+	APIKeys         APIKeysModelInterface
 	contextDuration time.Duration
 }
 
@@ -49,17 +58,45 @@ func Get(db *sql.DB, e *echo.Echo, ctxDuration time.Duration) (*Models, error) {
 			db: db,
 			e:  e,
 		},
+		Incidents: &IncidentsModel{
+			db: db,
+			e:  e,
+		},
+		Jobs: &JobsModel{
+			db: db,
+			e:  e,
+		},
+		Webhooks: &WebhooksModel{
+			db: db,
+			e:  e,
+		},
+		PasswordResets: &PasswordResetsModel{
+			db: db,
+			e:  e,
+		},
+		RefreshTokens: &RefreshTokensModel{
+			db: db,
+			e:  e,
+		},
+		APIKeys: &APIKeysModel{
+			db: db,
+			e:  e,
+		},
 	}
 
 	return m, nil
 }
 
 func InsertTestUser(m *Models) (int, error) {
-	userID, err := m.Users.Insert(ValidUserName, ValidUserPassword)
+	userID, err := m.Users.Insert(ValidUserName, ValidUserEmail, ValidUserPassword)
 	if err != nil {
 		return 0, err
 	}
 
+	if err = m.Users.Activate(userID); err != nil {
+		return 0, err
+	}
+
 	_, err = m.Users.Authenticate(ValidUserName, ValidUserPassword)
 	if err != nil {
 		return 0, err
@@ -105,12 +142,12 @@ func InsertTestForms(m *Models, userID int) ([]int, error) {
 		},
 	}
 
-	fid1, err := m.Forms.Insert(userID, "hapaxredux.com contact form", "Contact form for hapaxredux.com CTA.", form1Fields)
+	fid1, err := m.Forms.Insert(userID, "hapaxredux.com contact form", "Contact form for hapaxredux.com CTA.", form1Fields, types.FormSettings{})
 	if err != nil {
 		return nil, err
 	}
 
-	fid2, err := m.Forms.Insert(userID, "form2", "Form Two", form2Fields)
+	fid2, err := m.Forms.Insert(userID, "form2", "Form Two", form2Fields, types.FormSettings{})
 	if err != nil {
 		return nil, err
 	}
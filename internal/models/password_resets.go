@@ -0,0 +1,148 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordResetsModelInterface interface {
+	Insert(userID int, tokenHash string, expiresAt time.Time) error
+	GetUserID(tokenHash string) (int, error)
+	Reset(tokenHash, password string) (int, error)
+}
+
+// PasswordResetsModel stores the tokens that let users who forgot their
+// password set a new one. Only their hashes are kept, and each works once.
+type PasswordResetsModel struct {
+	db *sql.DB
+	e  *echo.Echo
+}
+
+// Insert stores a new token for the user and uses up their pending ones, so
+// only the link of the last email sent works, even when sending it is
+// retried.
+func (m *PasswordResetsModel) Insert(userID int, tokenHash string, expiresAt time.Time) error {
+	const stmtExpired = `DELETE FROM password_resets WHERE expires_at <= CURRENT_TIMESTAMP`
+	const stmtUsePending = `
+		UPDATE password_resets
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND used_at IS NULL
+	`
+	const stmt = `
+		INSERT INTO password_resets (user_id, token_hash, expires_at)
+		VALUES (?, ?, ?)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Expired tokens are useless, so they're cleaned up on the way.
+	if _, err = tx.ExecContext(ctx, stmtExpired); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, stmtUsePending, userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, stmt, userID, tokenHash, expiresAt.UTC().Format(sqliteTimeLayout)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUserID returns the user of an unused and unexpired token. It returns
+// ErrNoRecord otherwise.
+func (m *PasswordResetsModel) GetUserID(tokenHash string) (int, error) {
+	const query = `
+		SELECT user_id
+		FROM password_resets
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	`
+
+	var userID int
+	err := m.db.QueryRow(query, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// Reset uses up a token to set the password of its user. Every other pending
+// token of the user is used up too, and like UsersModel.RevokeSessions it
+// ends the sessions opened with the old password. It returns the user ID, or
+// ErrNoRecord if the token is unknown, used or expired.
+func (m *PasswordResetsModel) Reset(tokenHash, password string) (int, error) {
+	if password == "" {
+		return 0, ErrInvalidInput
+	}
+
+	const stmtUse = `
+		UPDATE password_resets
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id
+	`
+	const stmtUseOthers = `
+		UPDATE password_resets
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND used_at IS NULL
+	`
+	const stmtPassword = `
+		UPDATE users
+		SET password = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	if err = tx.QueryRowContext(ctx, stmtUse, tokenHash).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(ctx, stmtUseOthers, userID); err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(ctx, stmtPassword, string(passwordHash), userID); err != nil {
+		return 0, err
+	}
+
+	if err = revokeSessions(ctx, tx, userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrTokenReuse is returned when a refresh token that was already rotated is
+// presented again, which means it was copied. Its family gets revoked.
+var ErrTokenReuse = errors.New("models: refresh token reused")
+
+// ErrTokenRotated is returned when a refresh token is presented again within
+// the grace period after its rotation, while its successor is still valid.
+// Concurrent requests send the same token, so this isn't taken as reuse.
+var ErrTokenRotated = errors.New("models: refresh token just rotated")
+
+type RefreshTokensModelInterface interface {
+	Insert(userID int, tokenHash, family string, expiresAt time.Time) error
+	Rotate(tokenHash, newTokenHash string, expiresAt time.Time, grace time.Duration) (int, error)
+	RevokeFamily(tokenHash string) error
+	RevokeByUserID(userID int) error
+}
+
+// RefreshTokensModel stores the hashes of the refresh tokens handed out at
+// login. A token is used once: refreshing revokes it and issues the next
+// one of its family.
+type RefreshTokensModel struct {
+	db *sql.DB
+	e  *echo.Echo
+}
+
+func (m *RefreshTokensModel) Insert(userID int, tokenHash, family string, expiresAt time.Time) error {
+	const stmtExpired = `DELETE FROM refresh_tokens WHERE expires_at <= CURRENT_TIMESTAMP`
+	const stmt = `
+		INSERT INTO refresh_tokens (user_id, token, family, expires_at)
+		VALUES (?, ?, ?, ?)
+	`
+
+	if _, err := m.db.Exec(stmtExpired); err != nil {
+		return err
+	}
+
+	_, err := m.db.Exec(stmt, userID, tokenHash, family, expiresAt.UTC().Format(sqliteTimeLayout))
+	return err
+}
+
+// Rotate revokes a refresh token and stores newTokenHash in its family. It
+// returns the user of the token, ErrNoRecord if it's unknown or expired, or
+// ErrTokenReuse if it was revoked already. A token rotated less than grace
+// ago returns its user with ErrTokenRotated instead, as long as its
+// successor is still valid.
+func (m *RefreshTokensModel) Rotate(tokenHash, newTokenHash string, expiresAt time.Time, grace time.Duration) (int, error) {
+	const query = `
+		SELECT t.id, t.user_id, t.family, t.revoked, t.expires_at > CURRENT_TIMESTAMP,
+			t.rotated_at IS NOT NULL AND t.rotated_at > ? AND COALESCE(n.revoked = 0, 0)
+		FROM refresh_tokens t
+		LEFT JOIN refresh_tokens n ON n.token = t.replaced_by
+		WHERE t.token = ?
+	`
+	const stmtRevoke = `
+		UPDATE refresh_tokens
+		SET revoked = 1, rotated_at = CURRENT_TIMESTAMP, replaced_by = ?
+		WHERE id = ?
+	`
+	const stmtRevokeFamily = `UPDATE refresh_tokens SET revoked = 1 WHERE family = ?`
+	const stmtInsert = `
+		INSERT INTO refresh_tokens (user_id, token, family, expires_at)
+		VALUES (?, ?, ?, ?)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id, userID int
+	var family string
+	var revoked, valid, justRotated bool
+	rotatedAfter := time.Now().Add(-grace).UTC().Format(sqliteTimeLayout)
+	err = tx.QueryRowContext(ctx, query, rotatedAfter, tokenHash).Scan(&id, &userID, &family, &revoked, &valid, &justRotated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	if revoked && justRotated {
+		return userID, ErrTokenRotated
+	}
+	if revoked {
+		if _, err = tx.ExecContext(ctx, stmtRevokeFamily, family); err != nil {
+			return 0, err
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, err
+		}
+		return 0, ErrTokenReuse
+	}
+	if !valid {
+		return 0, ErrNoRecord
+	}
+
+	if _, err = tx.ExecContext(ctx, stmtRevoke, newTokenHash, id); err != nil {
+		return 0, err
+	}
+	if _, err = tx.ExecContext(ctx, stmtInsert, userID, newTokenHash, family, expiresAt.UTC().Format(sqliteTimeLayout)); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// RevokeFamily revokes a refresh token and every token rotated from the same
+// login. Unknown tokens are ignored.
+func (m *RefreshTokensModel) RevokeFamily(tokenHash string) error {
+	const stmt = `
+		UPDATE refresh_tokens
+		SET revoked = 1
+		WHERE family = (SELECT family FROM refresh_tokens WHERE token = ?)
+	`
+
+	_, err := m.db.Exec(stmt, tokenHash)
+	return err
+}
+
+// RevokeByUserID revokes every refresh token of a user.
+func (m *RefreshTokensModel) RevokeByUserID(userID int) error {
+	const stmt = `UPDATE refresh_tokens SET revoked = 1 WHERE user_id = ?`
+
+	_, err := m.db.Exec(stmt, userID)
+	return err
+}
@@ -3,15 +3,21 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"formy.fprzg.net/internal/types"
+	"formy.fprzg.net/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
 type SubmissionsModelInterface interface {
-	Insert(submission types.SubmissionData, ctx context.Context) (int, error)
-	//GetData(submissionID int) (types.SubmissionData, error)
+	Insert(submission types.SubmissionData, ctx context.Context, jobKinds ...string) (int, error)
+	GetData(submissionID int) (types.SubmissionData, error)
 	CheckForRepeatedUniqueField(formInstanceID int, fieldName, fieldHash string) (bool, error)
+	GetFile(userID, fileID int) (types.SubmissionFile, error)
+	GetByStatus(userID int, status string) ([]types.SubmissionData, error)
+	SetStatus(userID, submissionID int, status string) error
+	Delete(userID, submissionID int) error
 }
 
 type SubmissionsModel struct {
@@ -19,7 +25,11 @@ type SubmissionsModel struct {
 	e  *echo.Echo
 }
 
-func (m *SubmissionsModel) Insert(submission types.SubmissionData, ctx context.Context) (int, error) {
+// Insert stores submission and enqueues a job of each of jobKinds about it,
+// so the jobs exist if and only if the submission does. The same goes for
+// using up its render token: ErrFormTokenUsed is returned, and nothing is
+// stored, if the token was already used.
+func (m *SubmissionsModel) Insert(submission types.SubmissionData, ctx context.Context, jobKinds ...string) (int, error) {
 	m.e.Logger.Printf("Insert: starting submission insert for form ID %d.\n", submission.FormID)
 
 	ctx, cancel := context.WithTimeout(ctx, contextDuration)
@@ -43,22 +53,32 @@ func (m *SubmissionsModel) Insert(submission types.SubmissionData, ctx context.C
 	}()
 
 	const stmtSubmissionsInsert = `
-		INSERT INTO submissions (form_id, form_instance_id, metadata)
-		VALUES (?, ?, ?)
+		INSERT INTO submissions (form_id, form_instance_id, status, metadata)
+		VALUES (?, ?, ?, ?)
 		RETURNING id, submitted_at
 	`
-	err = tx.QueryRowContext(ctx, stmtSubmissionsInsert, submission.FormID, submission.FormInstanceID, submission.Metadata).Scan(&submission.ID, &submission.SubmittedAt)
+	if submission.Status == "" {
+		submission.Status = types.SubmissionStatusAccepted
+	}
+	err = tx.QueryRowContext(ctx, stmtSubmissionsInsert, submission.FormID, submission.FormInstanceID, submission.Status, submission.Metadata).Scan(&submission.ID, &submission.SubmittedAt)
 	if err != nil {
 		m.e.Logger.Printf("Insert: failed to insert submission: '%v'.\n", err)
 		return 0, err
 	}
 
+	if submission.Token != nil {
+		if err = useFormToken(ctx, tx, *submission.Token); err != nil {
+			m.e.Logger.Printf("Insert: failed to use form token: '%v'.\n", err)
+			return 0, err
+		}
+	}
+
 	for _, field := range submission.Fields {
 		const stmt = `
 			INSERT INTO submission_fields (submission_id, field_name, content)
 			VALUES (?, ?, ?)
 		`
-		_, err = tx.ExecContext(ctx, stmt, submission.ID, field.Name, field.Content)
+		_, err = tx.ExecContext(ctx, stmt, submission.ID, field.Name, field.ContentAsString)
 		if err != nil {
 			m.e.Logger.Printf("Insert: failed to insert field '%s': '%v'.\n", field.Name, err)
 			return 0, err
@@ -77,12 +97,146 @@ func (m *SubmissionsModel) Insert(submission types.SubmissionData, ctx context.C
 		}
 	}
 
+	for _, file := range submission.Files {
+		const stmt = `
+			INSERT INTO submission_files (submission_id, field_name, file_name, mime_type, size, blob_hash)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`
+		_, err = tx.ExecContext(ctx, stmt, submission.ID, file.FieldName, file.FileName, file.MimeType, file.Size, file.Hash)
+		if err != nil {
+			m.e.Logger.Printf("Insert: failed to insert file '%s': '%v'.\n", file.FieldName, err)
+			return 0, err
+		}
+	}
+
+	if len(submission.UnexpectedFields) > 0 {
+		incident := types.Incident{
+			FormID:       submission.FormID,
+			SubmissionID: submission.ID,
+			Kind:         types.IncidentUnexpectedFields,
+			Policy:       types.UnexpectedFieldsStore,
+		}
+
+		for _, field := range submission.UnexpectedFields {
+			const stmt = `
+				INSERT INTO submission_unexpected_fields (submission_id, field_name, content)
+				VALUES (?, ?, ?)
+			`
+			_, err = tx.ExecContext(ctx, stmt, submission.ID, field.Name, field.Content)
+			if err != nil {
+				m.e.Logger.Printf("Insert: failed to insert unexpected field '%s': '%v'.\n", field.Name, err)
+				return 0, err
+			}
+			incident.Fields = append(incident.Fields, field.Name)
+		}
+
+		if _, err = insertIncident(ctx, tx, incident); err != nil {
+			m.e.Logger.Printf("Insert: failed to insert incident: '%v'.\n", err)
+			return 0, err
+		}
+	}
+
+	for _, kind := range jobKinds {
+		if _, err = insertJob(ctx, tx, kind, types.SubmissionJob{SubmissionID: submission.ID}); err != nil {
+			m.e.Logger.Printf("Insert: failed to enqueue %s job: '%v'.\n", kind, err)
+			return 0, err
+		}
+	}
+
 	m.e.Logger.Printf("Insert: submission inserted successfully with ID %d.\n", submission.ID)
 	return submission.ID, nil
 }
 
+// GetData returns a submission with its fields, files and unexpected fields.
+// It doesn't check who owns the form, so it's meant for background work.
 func (m *SubmissionsModel) GetData(submissionID int) (types.SubmissionData, error) {
-	return types.SubmissionData{}, nil
+	const query = `
+		SELECT id, form_id, form_instance_id, status, metadata, submitted_at
+		FROM submissions
+		WHERE id = ?
+	`
+
+	const queryFields = `
+		SELECT field_name, content
+		FROM submission_fields
+		WHERE submission_id = ?
+	`
+
+	const queryFiles = `
+		SELECT id, submission_id, field_name, file_name, mime_type, size, blob_hash, created_at
+		FROM submission_files
+		WHERE submission_id = ?
+		ORDER BY id
+	`
+
+	const queryUnexpected = `
+		SELECT field_name, content
+		FROM submission_unexpected_fields
+		WHERE submission_id = ?
+		ORDER BY field_name
+	`
+
+	var sub types.SubmissionData
+	err := m.db.QueryRow(query, submissionID).Scan(&sub.ID, &sub.FormID, &sub.FormInstanceID, &sub.Status, &sub.Metadata, &sub.SubmittedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.SubmissionData{}, ErrNoRecord
+		}
+		return types.SubmissionData{}, err
+	}
+
+	rows, err := m.db.Query(queryFields, submissionID)
+	if err != nil {
+		return types.SubmissionData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var field types.SubmissionField
+		if err = rows.Scan(&field.Name, &field.ContentAsString); err != nil {
+			return types.SubmissionData{}, err
+		}
+		sub.Fields = append(sub.Fields, field)
+	}
+	if err = rows.Err(); err != nil {
+		return types.SubmissionData{}, err
+	}
+
+	fileRows, err := m.db.Query(queryFiles, submissionID)
+	if err != nil {
+		return types.SubmissionData{}, err
+	}
+	defer fileRows.Close()
+
+	for fileRows.Next() {
+		var f types.SubmissionFile
+		if err = fileRows.Scan(&f.ID, &f.SubmissionID, &f.FieldName, &f.FileName, &f.MimeType, &f.Size, &f.Hash, &f.CreatedAt); err != nil {
+			return types.SubmissionData{}, err
+		}
+		sub.Files = append(sub.Files, f)
+	}
+	if err = fileRows.Err(); err != nil {
+		return types.SubmissionData{}, err
+	}
+
+	unexpectedRows, err := m.db.Query(queryUnexpected, submissionID)
+	if err != nil {
+		return types.SubmissionData{}, err
+	}
+	defer unexpectedRows.Close()
+
+	for unexpectedRows.Next() {
+		var field types.UnexpectedField
+		if err = unexpectedRows.Scan(&field.Name, &field.Content); err != nil {
+			return types.SubmissionData{}, err
+		}
+		sub.UnexpectedFields = append(sub.UnexpectedFields, field)
+	}
+	if err = unexpectedRows.Err(); err != nil {
+		return types.SubmissionData{}, err
+	}
+
+	return sub, nil
 }
 
 func (m *SubmissionsModel) CheckForRepeatedUniqueField(formInstanceID int, fieldName, fieldHash string) (bool, error) {
@@ -100,3 +254,159 @@ func (m *SubmissionsModel) CheckForRepeatedUniqueField(formInstanceID int, field
 	err := m.db.QueryRow(query, formInstanceID, fieldName, fieldHash).Scan(&exists)
 	return exists, err
 }
+
+// GetFile returns the metadata of an uploaded file, as long as it belongs to a
+// submission of one of the user's forms.
+func (m *SubmissionsModel) GetFile(userID, fileID int) (types.SubmissionFile, error) {
+	const query = `
+		SELECT sf.id, sf.submission_id, sf.field_name, sf.file_name, sf.mime_type, sf.size, sf.blob_hash, sf.created_at
+		FROM submission_files sf
+		JOIN submissions s ON s.id = sf.submission_id
+		JOIN forms f ON f.id = s.form_id
+		WHERE sf.id = ? AND f.user_id = ?
+	`
+
+	var f types.SubmissionFile
+	err := m.db.QueryRow(query, fileID, userID).Scan(&f.ID, &f.SubmissionID, &f.FieldName, &f.FileName, &f.MimeType, &f.Size, &f.Hash, &f.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.SubmissionFile{}, ErrNoRecord
+		}
+		return types.SubmissionFile{}, err
+	}
+
+	return f, nil
+}
+
+// GetByStatus returns the submissions with the given status received by the
+// user's forms, newest first.
+func (m *SubmissionsModel) GetByStatus(userID int, status string) ([]types.SubmissionData, error) {
+	const query = `
+		SELECT s.id, s.form_id, s.form_instance_id, s.status, s.metadata, s.submitted_at
+		FROM submissions s
+		JOIN forms f ON f.id = s.form_id
+		WHERE f.user_id = ? AND s.status = ?
+		ORDER BY s.id DESC
+	`
+
+	const queryFields = `
+		SELECT sf.submission_id, sf.field_name, sf.content
+		FROM submission_fields sf
+		JOIN submissions s ON s.id = sf.submission_id
+		JOIN forms f ON f.id = s.form_id
+		WHERE f.user_id = ? AND s.status = ?
+	`
+
+	rows, err := m.db.Query(query, userID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var submissions []types.SubmissionData
+	byID := make(map[int]int)
+	for rows.Next() {
+		var sub types.SubmissionData
+		err = rows.Scan(&sub.ID, &sub.FormID, &sub.FormInstanceID, &sub.Status, &sub.Metadata, &sub.SubmittedAt)
+		if err != nil {
+			return nil, err
+		}
+		byID[sub.ID] = len(submissions)
+		submissions = append(submissions, sub)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fieldRows, err := m.db.Query(queryFields, userID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer fieldRows.Close()
+
+	for fieldRows.Next() {
+		var submissionID int
+		var field types.SubmissionField
+		err = fieldRows.Scan(&submissionID, &field.Name, &field.ContentAsString)
+		if err != nil {
+			return nil, err
+		}
+		if idx, ok := byID[submissionID]; ok {
+			submissions[idx].Fields = append(submissions[idx].Fields, field)
+		}
+	}
+	if err = fieldRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return submissions, nil
+}
+
+// SetStatus moves a submission of one of the user's forms to status, e.g. to
+// accept a submission wrongly quarantined as spam.
+func (m *SubmissionsModel) SetStatus(userID, submissionID int, status string) error {
+	const stmt = `
+		UPDATE submissions
+		SET status = ?
+		WHERE id = ? AND form_id IN (SELECT id FROM forms WHERE user_id = ?)
+	`
+
+	rows, err := utils.ExecuteSqlStmt(m.db, stmt, status, submissionID, userID)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Delete removes a submission of one of the user's forms with its fields.
+// Children are deleted explicitly since foreign keys may not be enforced on
+// every connection.
+func (m *SubmissionsModel) Delete(userID, submissionID int) error {
+	const stmtOwned = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM submissions s
+			JOIN forms f ON f.id = s.form_id
+			WHERE s.id = ? AND f.user_id = ?
+		)
+	`
+
+	stmts := []string{
+		`DELETE FROM submission_fields WHERE submission_id = ?`,
+		`DELETE FROM unique_submission_fields WHERE submission_id = ?`,
+		`DELETE FROM submission_files WHERE submission_id = ?`,
+		`DELETE FROM submission_unexpected_fields WHERE submission_id = ?`,
+		`UPDATE incidents SET submission_id = NULL WHERE submission_id = ?`,
+		`UPDATE webhook_deliveries SET submission_id = NULL WHERE submission_id = ?`,
+		`DELETE FROM submissions WHERE id = ?`,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owned bool
+	if err = tx.QueryRowContext(ctx, stmtOwned, submissionID, userID).Scan(&owned); err != nil {
+		return err
+	}
+	if !owned {
+		return ErrNoRecord
+	}
+
+	for _, stmt := range stmts {
+		if _, err = tx.ExecContext(ctx, stmt, submissionID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"formy.fprzg.net/internal/types"
+)
+
+// sqliteTimeLayout matches CURRENT_TIMESTAMP so stored times compare with it.
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// ErrFormTokenUsed is returned when a submission comes with a render token
+// that was already used to submit its form.
+var ErrFormTokenUsed = errors.New("models: form token already used")
+
+// useFormToken marks token as used until it expires, so replayed tokens can
+// be detected. It returns ErrFormTokenUsed if it already was.
+func useFormToken(ctx context.Context, db execer, token types.FormToken) error {
+	const stmtCleanup = `
+		DELETE FROM used_form_tokens
+		WHERE expires_at < CURRENT_TIMESTAMP
+	`
+
+	const stmt = `
+		INSERT INTO used_form_tokens (nonce, form_id, expires_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (nonce) DO NOTHING
+	`
+
+	if _, err := db.ExecContext(ctx, stmtCleanup); err != nil {
+		return err
+	}
+
+	rows, err := db.ExecContext(ctx, stmt, token.Nonce, token.FormID, token.ExpiresAt.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return err
+	}
+
+	inserted, err := rows.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrFormTokenUsed
+	}
+
+	return nil
+}
@@ -1,11 +1,13 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"strings"
 	"time"
 
+	"formy.fprzg.net/internal/types"
 	"formy.fprzg.net/internal/utils"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -13,6 +15,8 @@ import (
 
 type User struct {
 	UserName    string    `json:"user_name"`
+	Email       string    `json:"email"`
+	IsActive    bool      `json:"is_active"`
 	CreatedAt   time.Time `json:"created_at"`
 	LastUpdated time.Time `json:"last_updated"`
 	LastLogin   time.Time `json:"last_login"`
@@ -25,10 +29,15 @@ type userData struct {
 }
 
 type UsersModelInterface interface {
-	Insert(nameName, password string) (int, error)
+	Insert(userName, email, password string) (int, error)
 	Authenticate(userName, password string) (int, error)
 	Exists(id int) (bool, error)
 	Get(id int) (User, error)
+	GetIDByEmail(email string) (int, error)
+	GetIDByUserName(userName string) (int, error)
+	Activate(id int) error
+	GetTokenVersion(id int) (int, error)
+	RevokeSessions(id int) error
 	UpdatePassword(id int, oldPwd, newPwd string) error
 }
 
@@ -37,14 +46,17 @@ type UsersModel struct {
 	e  *echo.Echo
 }
 
-func (m *UsersModel) Insert(userName, password string) (int, error) {
-	if userName == "" || password == "" {
+// Insert adds an inactive user, which can't log in until Activate is called.
+// It returns ErrDuplicateUserName or ErrDuplicateEmail if another user has
+// them already.
+func (m *UsersModel) Insert(userName, email, password string) (int, error) {
+	if userName == "" || password == "" || !types.IsEmail(email) {
 		return 0, ErrInvalidInput
 	}
 
 	const query = `
-	INSERT INTO users (user_name, password)
-	VALUES (?, ?)
+	INSERT INTO users (user_name, email, password)
+	VALUES (?, ?, ?)
 	RETURNING id, created_at, updated_at
 	`
 
@@ -55,9 +67,12 @@ func (m *UsersModel) Insert(userName, password string) (int, error) {
 
 	var u userData
 	u.UserName = userName
-	err = m.db.QueryRow(query, userName, passwordHash).Scan(&u.ID, &u.CreatedAt, &u.LastUpdated)
+	err = m.db.QueryRow(query, userName, email, passwordHash).Scan(&u.ID, &u.CreatedAt, &u.LastUpdated)
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed: users.user_name") {
+		switch {
+		case strings.Contains(err.Error(), "UNIQUE constraint failed: users.user_name"):
+			return 0, ErrDuplicateUserName
+		case strings.Contains(err.Error(), "UNIQUE constraint failed: users.email"):
 			return 0, ErrDuplicateEmail
 		}
 		return 0, err
@@ -66,15 +81,18 @@ func (m *UsersModel) Insert(userName, password string) (int, error) {
 	return u.ID, nil
 }
 
+// Authenticate returns the ID of the user with userName and password. It
+// returns ErrInactiveAccount if the credentials are right but the account
+// hasn't been activated yet.
 func (m *UsersModel) Authenticate(userName, password string) (int, error) {
 	const query = `
-	SELECT id, password
+	SELECT id, password, is_active
 	FROM users
 	WHERE user_name = ?
 	`
 
 	var u userData
-	err := m.db.QueryRow(query, userName).Scan(&u.ID, &u.PasswordHash)
+	err := m.db.QueryRow(query, userName).Scan(&u.ID, &u.PasswordHash, &u.IsActive)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -90,6 +108,10 @@ func (m *UsersModel) Authenticate(userName, password string) (int, error) {
 		return 0, err
 	}
 
+	if !u.IsActive {
+		return 0, ErrInactiveAccount
+	}
+
 	return u.ID, nil
 }
 
@@ -143,13 +165,13 @@ func (m *UsersModel) Exists(id int) (bool, error) {
 
 func (m *UsersModel) Get(id int) (User, error) {
 	const query = `
-	SELECT user_name, created_at, updated_at, last_login
+	SELECT user_name, COALESCE(email, ''), is_active, created_at, updated_at, last_login
 	FROM users
 	WHERE id = ?
 	`
 
 	var u User
-	err := m.db.QueryRow(query, id).Scan(&u.UserName, &u.CreatedAt, &u.LastUpdated, &u.LastLogin)
+	err := m.db.QueryRow(query, id).Scan(&u.UserName, &u.Email, &u.IsActive, &u.CreatedAt, &u.LastUpdated, &u.LastLogin)
 	if err == sql.ErrNoRows {
 		if errors.Is(err, sql.ErrNoRows) {
 			return User{}, ErrNoRecord
@@ -160,14 +182,125 @@ func (m *UsersModel) Get(id int) (User, error) {
 	return u, err
 }
 
+func (m *UsersModel) GetIDByEmail(email string) (int, error) {
+	const query = `
+	SELECT id
+	FROM users
+	WHERE email = ?
+	`
+
+	var id int
+	err := m.db.QueryRow(query, email).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m *UsersModel) GetIDByUserName(userName string) (int, error) {
+	const query = `
+	SELECT id
+	FROM users
+	WHERE user_name = ?
+	`
+
+	var id int
+	err := m.db.QueryRow(query, userName).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Activate lets the user log in. Activating an active user does nothing.
+func (m *UsersModel) Activate(id int) error {
+	const query = `
+	UPDATE users
+	SET is_active = 1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+
+	rows, err := utils.ExecuteSqlStmt(m.db, query, id)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetTokenVersion returns the version the access tokens of a user must
+// carry. Tokens issued before it was bumped are no longer valid.
+func (m *UsersModel) GetTokenVersion(id int) (int, error) {
+	const query = `
+	SELECT COALESCE(token_version, 0)
+	FROM users
+	WHERE id = ?
+	`
+
+	var version int
+	err := m.db.QueryRow(query, id).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// RevokeSessions logs a user out everywhere: it bumps their token version
+// and revokes their refresh tokens.
+func (m *UsersModel) RevokeSessions(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	return revokeSessions(ctx, m.db, id)
+}
+
+func revokeSessions(ctx context.Context, db execer, userID int) error {
+	const stmtVersion = `
+	UPDATE users
+	SET token_version = COALESCE(token_version, 0) + 1
+	WHERE id = ?
+	`
+	const stmtRevoke = `UPDATE refresh_tokens SET revoked = 1 WHERE user_id = ?`
+
+	res, err := db.ExecContext(ctx, stmtVersion, userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	_, err = db.ExecContext(ctx, stmtRevoke, userID)
+	return err
+}
+
+// UpdatePassword changes the password of a user and, like RevokeSessions,
+// ends every session opened with the old one.
 func (m *UsersModel) UpdatePassword(id int, oldPwd, newPwdRaw string) error {
 	if newPwdRaw == "" {
 		return ErrInvalidInput
 	}
 
-	const query = `
+	const stmt = `
 	UPDATE users
-	SET password = ?
+	SET password = ?, updated_at = CURRENT_TIMESTAMP
 	WHERE id = ?
 	`
 
@@ -181,10 +314,22 @@ func (m *UsersModel) UpdatePassword(id int, oldPwd, newPwdRaw string) error {
 		return err
 	}
 
-	rows, err := utils.ExecuteSqlStmt(m.db, query, string(newPwd), id)
-	if rows == 0 {
-		return ErrUserNotFound
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return err
+	if _, err = tx.ExecContext(ctx, stmt, string(newPwd), id); err != nil {
+		return err
+	}
+
+	if err = revokeSessions(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,356 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"formy.fprzg.net/internal/types"
+	"github.com/labstack/echo/v4"
+)
+
+// maxDeliveriesListed caps the deliveries returned for a webhook.
+const maxDeliveriesListed = 50
+
+type WebhooksModelInterface interface {
+	Insert(userID, formID int, url, secret string) (int, error)
+	Get(userID, webhookID int) (types.Webhook, error)
+	GetByFormID(formID int) ([]types.Webhook, error)
+	GetByUserID(userID int) ([]types.Webhook, error)
+	Delete(userID, webhookID int) error
+	InsertDeliveries(deliveries []types.WebhookDelivery, jobKind string) ([]int, error)
+	Redeliver(userID, deliveryID int, jobKind string) (int, error)
+	GetDelivery(deliveryID int) (types.WebhookDelivery, types.Webhook, error)
+	GetDeliveries(userID, webhookID int) ([]types.WebhookDelivery, error)
+	RecordAttempt(delivery types.WebhookDelivery) error
+}
+
+// WebhooksModel stores the webhooks of the forms and the log of what was
+// delivered to them. Every delivery is sent by a job enqueued in the same
+// transaction that creates it.
+type WebhooksModel struct {
+	db *sql.DB
+	e  *echo.Echo
+}
+
+const webhookColumns = `w.id, w.form_id, f.name, w.url, w.secret, w.created_at`
+
+func scanWebhook(row interface{ Scan(...any) error }) (types.Webhook, error) {
+	var w types.Webhook
+	err := row.Scan(&w.ID, &w.FormID, &w.FormName, &w.URL, &w.Secret, &w.CreatedAt)
+	return w, err
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.submission_id, d.event, d.payload, d.status, d.attempts,
+	d.status_code, d.response_excerpt, d.error, d.created_at, d.delivered_at`
+
+func scanDelivery(row interface{ Scan(...any) error }, extra ...any) (types.WebhookDelivery, error) {
+	var d types.WebhookDelivery
+	var submissionID sql.NullInt64
+	var payload string
+	var deliveredAt sql.NullString
+
+	dest := []any{&d.ID, &d.WebhookID, &submissionID, &d.Event, &payload, &d.Status, &d.Attempts,
+		&d.StatusCode, &d.ResponseExcerpt, &d.Error, &d.CreatedAt, &deliveredAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return types.WebhookDelivery{}, err
+	}
+
+	d.SubmissionID = int(submissionID.Int64)
+	d.Payload = []byte(payload)
+	d.DeliveredAt = deliveredAt.String
+	return d, nil
+}
+
+// Insert adds a webhook to one of the user's forms. It returns
+// ErrFormNotFound if the user doesn't own the form.
+func (m *WebhooksModel) Insert(userID, formID int, url, secret string) (int, error) {
+	const stmt = `
+		INSERT INTO webhooks (form_id, url, secret)
+		SELECT id, ?, ?
+		FROM forms
+		WHERE id = ? AND user_id = ?
+	`
+
+	result, err := m.db.Exec(stmt, url, secret, formID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, ErrFormNotFound
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (m *WebhooksModel) Get(userID, webhookID int) (types.Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks w
+		JOIN forms f ON f.id = w.form_id
+		WHERE w.id = ? AND f.user_id = ?
+	`
+
+	w, err := scanWebhook(m.db.QueryRow(query, webhookID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.Webhook{}, ErrNoRecord
+		}
+		return types.Webhook{}, err
+	}
+	return w, nil
+}
+
+func (m *WebhooksModel) GetByFormID(formID int) ([]types.Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks w
+		JOIN forms f ON f.id = w.form_id
+		WHERE w.form_id = ?
+		ORDER BY w.id
+	`
+
+	return m.query(query, formID)
+}
+
+// GetByUserID returns the webhooks of all the user's forms, ordered by form.
+func (m *WebhooksModel) GetByUserID(userID int) ([]types.Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks w
+		JOIN forms f ON f.id = w.form_id
+		WHERE f.user_id = ?
+		ORDER BY w.form_id, w.id
+	`
+
+	return m.query(query, userID)
+}
+
+func (m *WebhooksModel) query(query string, args ...any) ([]types.Webhook, error) {
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []types.Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete removes one of the user's webhooks with its deliveries.
+func (m *WebhooksModel) Delete(userID, webhookID int) error {
+	const stmtOwned = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM webhooks w
+			JOIN forms f ON f.id = w.form_id
+			WHERE w.id = ? AND f.user_id = ?
+		)
+	`
+
+	stmts := []string{
+		`DELETE FROM webhook_deliveries WHERE webhook_id = ?`,
+		`DELETE FROM webhooks WHERE id = ?`,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owned bool
+	if err = tx.QueryRowContext(ctx, stmtOwned, webhookID, userID).Scan(&owned); err != nil {
+		return err
+	}
+	if !owned {
+		return ErrNoRecord
+	}
+
+	for _, stmt := range stmts {
+		if _, err = tx.ExecContext(ctx, stmt, webhookID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// InsertDeliveries stores deliveries and enqueues a job of jobKind to send
+// each of them. It returns the IDs of the new deliveries.
+func (m *WebhooksModel) InsertDeliveries(deliveries []types.WebhookDelivery, jobKind string) ([]int, error) {
+	const stmt = `
+		INSERT INTO webhook_deliveries (webhook_id, submission_id, event, payload)
+		VALUES (?, ?, ?, ?)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int, 0, len(deliveries))
+	for _, d := range deliveries {
+		var submissionID sql.NullInt64
+		if d.SubmissionID != 0 {
+			submissionID = sql.NullInt64{Int64: int64(d.SubmissionID), Valid: true}
+		}
+
+		result, err := tx.ExecContext(ctx, stmt, d.WebhookID, submissionID, d.Event, string(d.Payload))
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, int(id))
+
+		if _, err = insertJob(ctx, tx, jobKind, types.WebhookDeliveryJob{DeliveryID: int(id)}); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, tx.Commit()
+}
+
+// Redeliver copies a delivery of one of the user's webhooks into a new one
+// and enqueues a job of jobKind to send it. It returns the new delivery ID.
+func (m *WebhooksModel) Redeliver(userID, deliveryID int, jobKind string) (int, error) {
+	const stmt = `
+		INSERT INTO webhook_deliveries (webhook_id, submission_id, event, payload)
+		SELECT d.webhook_id, d.submission_id, d.event, d.payload
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		JOIN forms f ON f.id = w.form_id
+		WHERE d.id = ? AND f.user_id = ?
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, stmt, deliveryID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, ErrNoRecord
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = insertJob(ctx, tx, jobKind, types.WebhookDeliveryJob{DeliveryID: int(id)}); err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+// GetDelivery returns a delivery and the webhook it's for. It doesn't check
+// who owns them, so it's meant for the jobs that send deliveries.
+func (m *WebhooksModel) GetDelivery(deliveryID int) (types.WebhookDelivery, types.Webhook, error) {
+	query := `
+		SELECT ` + deliveryColumns + `, ` + webhookColumns + `
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		JOIN forms f ON f.id = w.form_id
+		WHERE d.id = ?
+	`
+
+	var w types.Webhook
+	d, err := scanDelivery(m.db.QueryRow(query, deliveryID), &w.ID, &w.FormID, &w.FormName, &w.URL, &w.Secret, &w.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.WebhookDelivery{}, types.Webhook{}, ErrNoRecord
+		}
+		return types.WebhookDelivery{}, types.Webhook{}, err
+	}
+
+	return d, w, nil
+}
+
+// GetDeliveries returns the latest deliveries of one of the user's webhooks,
+// newest first.
+func (m *WebhooksModel) GetDeliveries(userID, webhookID int) ([]types.WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		JOIN forms f ON f.id = w.form_id
+		WHERE d.webhook_id = ? AND f.user_id = ?
+		ORDER BY d.id DESC
+		LIMIT ?
+	`
+
+	rows, err := m.db.Query(query, webhookID, userID, maxDeliveriesListed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []types.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordAttempt stores the outcome of an attempt to send delivery.
+func (m *WebhooksModel) RecordAttempt(delivery types.WebhookDelivery) error {
+	const stmt = `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, status_code = ?, response_excerpt = ?, error = ?,
+			delivered_at = CASE WHEN ? = 'succeeded' THEN CURRENT_TIMESTAMP ELSE delivered_at END
+		WHERE id = ?
+	`
+
+	_, err := m.db.Exec(stmt, delivery.Status, delivery.StatusCode, delivery.ResponseExcerpt, delivery.Error, delivery.Status, delivery.ID)
+	return err
+}
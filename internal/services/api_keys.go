@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to spot.
+const apiKeyPrefix = "fmy_"
+
+// apiKeyShownLength is how much of a key is kept to tell it apart.
+const apiKeyShownLength = len(apiKeyPrefix) + 6
+
+var ErrInvalidAPIKey = errors.New("services: invalid or expired API key")
+
+// CreateAPIKey creates a key for userID and returns it. This is the only time
+// the key is available; only its hash is stored.
+func (s *Services) CreateAPIKey(userID int, req types.NewAPIKey) (string, types.APIKey, error) {
+	if errs := req.Validate(); len(errs) > 0 {
+		return "", types.APIKey{}, errs
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return "", types.APIKey{}, err
+	}
+	key := apiKeyPrefix + token
+
+	var expiresAt time.Time
+	if req.ExpiresInDays > 0 {
+		expiresAt = time.Now().AddDate(0, 0, req.ExpiresInDays)
+	}
+
+	name := strings.TrimSpace(req.Name)
+	id, err := s.models.APIKeys.Insert(userID, name, key[:apiKeyShownLength], hashToken(key), req.Scopes, expiresAt)
+	if err != nil {
+		return "", types.APIKey{}, err
+	}
+
+	return key, types.APIKey{
+		ID:     id,
+		UserID: userID,
+		Name:   name,
+		Prefix: key[:apiKeyShownLength],
+		Scopes: req.Scopes,
+	}, nil
+}
+
+// AuthenticateAPIKey returns the key sent as a bearer token, or
+// ErrInvalidAPIKey if it's unknown or expired.
+func (s *Services) AuthenticateAPIKey(key string) (types.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return types.APIKey{}, ErrInvalidAPIKey
+	}
+
+	k, err := s.models.APIKeys.Authenticate(hashToken(key))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return types.APIKey{}, ErrInvalidAPIKey
+		}
+		return types.APIKey{}, err
+	}
+
+	return k, nil
+}
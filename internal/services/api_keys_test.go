@@ -0,0 +1,71 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeys(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	s := &Services{models: m, e: e}
+
+	userID, err := models.InsertTestUser(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, _, err = s.CreateAPIKey(userID, types.NewAPIKey{Name: "CI"})
+	assert.ErrorAs(t, err, &types.ValidationErrors{})
+
+	key, created, err := s.CreateAPIKey(userID, types.NewAPIKey{Name: " CI ", Scopes: []string{types.ScopeFormsRead}, ExpiresInDays: 7})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(key, created.Prefix))
+	assert.Equal(t, "CI", created.Name)
+
+	// Only the hash is stored.
+	var stored string
+	assert.NoError(t, db.QueryRow(`SELECT key_hash FROM api_keys WHERE id = ?`, created.ID).Scan(&stored))
+	assert.Equal(t, hashToken(key), stored)
+
+	apiKey, err := s.AuthenticateAPIKey(key)
+	if assert.NoError(t, err) {
+		assert.Equal(t, userID, apiKey.UserID)
+		assert.True(t, apiKey.HasScope(types.ScopeFormsRead))
+		assert.False(t, apiKey.HasScope(types.ScopeFormsWrite))
+		assert.NotEmpty(t, apiKey.LastUsedAt)
+		assert.NotEmpty(t, apiKey.ExpiresAt)
+	}
+
+	for _, bad := range []string{"", "fmy_made-up", strings.TrimPrefix(key, apiKeyPrefix)} {
+		_, err = s.AuthenticateAPIKey(bad)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	}
+
+	_, err = m.APIKeys.Insert(userID, "old", "fmy_old", hashToken("fmy_old"), []string{types.ScopeFormsRead}, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	_, err = s.AuthenticateAPIKey("fmy_old")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	assert.ErrorIs(t, m.APIKeys.Delete(userID+1, created.ID), models.ErrNoRecord)
+	assert.NoError(t, m.APIKeys.Delete(userID, created.ID))
+	_, err = s.AuthenticateAPIKey(key)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
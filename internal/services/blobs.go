@@ -0,0 +1,80 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// BlobStore is a content-addressed store for uploaded files. Every blob is
+// saved under the hex encoded SHA-256 of its content, so uploading the same
+// file twice only keeps one copy on disk.
+type BlobStore struct {
+	dir string
+}
+
+func NewBlobStore(dir string) (*BlobStore, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	return &BlobStore{dir: dir}, nil
+}
+
+// Put copies r into the store and returns the hash and size of its content.
+func (bs *BlobStore) Put(r io.Reader) (string, int64, error) {
+	tmp, err := os.CreateTemp(bs.dir, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return "", 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	path := bs.path(hash)
+
+	if _, err = os.Stat(path); err == nil {
+		return hash, size, nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return "", 0, err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+
+	return hash, size, nil
+}
+
+func (bs *BlobStore) Open(hash string) (*os.File, error) {
+	if !validBlobHash(hash) {
+		return nil, fmt.Errorf("blobs: invalid hash '%s'", hash)
+	}
+
+	return os.Open(bs.path(hash))
+}
+
+func (bs *BlobStore) path(hash string) string {
+	return filepath.Join(bs.dir, hash[:2], hash)
+}
+
+func validBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
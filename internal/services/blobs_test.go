@@ -0,0 +1,62 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobStore(t *testing.T) {
+	dir := t.TempDir()
+	bs, err := NewBlobStore(filepath.Join(dir, "blobs"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sum := sha256.Sum256([]byte("hola"))
+	expected := hex.EncodeToString(sum[:])
+
+	hash, size, err := bs.Put(strings.NewReader("hola"))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, hash)
+	assert.Equal(t, int64(4), size)
+
+	// Blobs are kept under the first two characters of their hash.
+	_, err = os.Stat(filepath.Join(dir, "blobs", hash[:2], hash))
+	assert.NoError(t, err)
+
+	// The same content is only stored once, and no temporary files are left.
+	again, _, err := bs.Put(strings.NewReader("hola"))
+	assert.NoError(t, err)
+	assert.Equal(t, hash, again)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "blobs"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	entries, err = os.ReadDir(filepath.Join(dir, "blobs", hash[:2]))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	other, _, err := bs.Put(strings.NewReader("adiós"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	f, err := bs.Open(hash)
+	if assert.NoError(t, err) {
+		content, err := io.ReadAll(f)
+		f.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "hola", string(content))
+	}
+
+	for _, invalid := range []string{"", "../../etc/passwd", strings.Repeat("z", 64), hash[:10]} {
+		_, err = bs.Open(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
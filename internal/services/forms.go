@@ -6,22 +6,25 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"formy.fprzg.net/internal/models"
 	"formy.fprzg.net/internal/types"
 )
 
 type FormsServiceInterface interface {
-	ProcessForm(r *http.Request, ctx context.Context) (int, error)
+	ProcessForm(userID int, r *http.Request) (int, error)
 	GetFormFromRequest(r *http.Request, ctx context.Context) (types.FormData, error)
 }
 
-func (s *Services) ProcessForm(r *http.Request, ctx context.Context) (int, error) {
+// ProcessForm creates a form for userID from a urlencoded request.
+func (s *Services) ProcessForm(userID int, r *http.Request) (int, error) {
 	formData, err := s.GetFormFromRequest(r, r.Context())
 	if err != nil {
 		return 0, err
 	}
 
-	formID, err := s.models.Forms.Insert(formData.UserID, formData.Name, formData.Description, formData.Fields)
+	formID, err := s.models.Forms.Insert(userID, formData.Name, formData.Description, formData.Fields, formData.Settings)
 	if err != nil {
 		return 0, err
 	}
@@ -29,29 +32,134 @@ func (s *Services) ProcessForm(r *http.Request, ctx context.Context) (int, error
 	return formID, nil
 }
 
-func (s *Services) GetFormFromRequest(r *http.Request, ctx context.Context) (types.FormData, error) {
-	if err := r.ParseForm(); err != nil {
+// UserForm returns a form of userID. Forms of other users are reported as
+// models.ErrFormNotFound, so their IDs can't be probed.
+func (s *Services) UserForm(userID, formID int) (types.FormData, error) {
+	form, err := s.models.Forms.Get(formID)
+	if err != nil {
 		return types.FormData{}, err
 	}
+	if form.UserID != userID {
+		return types.FormData{}, models.ErrFormNotFound
+	}
+
+	return form, nil
+}
+
+// CreateForm creates a form for userID from its JSON definition and returns
+// it as stored.
+func (s *Services) CreateForm(userID int, form types.FormData) (types.FormData, error) {
+	var errs types.ValidationErrors
+	if strings.TrimSpace(form.Name) == "" {
+		errs = append(errs, types.FieldError{Field: "name", Constraint: types.ConstraintRequired, Message: "field is required"})
+	}
+	if len(form.Fields) == 0 {
+		errs = append(errs, types.FieldError{Field: "fields", Constraint: types.ConstraintRequired, Message: "form has to have at least one field"})
+	}
+	if len(errs) > 0 {
+		return types.FormData{}, errs
+	}
 
-	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	formID, err := s.models.Forms.Insert(userID, strings.TrimSpace(form.Name), form.Description, form.Fields, form.Settings)
 	if err != nil {
 		return types.FormData{}, err
 	}
 
+	return s.models.Forms.Get(formID)
+}
+
+// PatchForm updates a form of userID and returns it as stored.
+func (s *Services) PatchForm(userID, formID int, patch types.FormPatch) (types.FormData, error) {
+	var errs types.ValidationErrors
+	if patch.Name != nil {
+		name := strings.TrimSpace(*patch.Name)
+		if name == "" {
+			errs = append(errs, types.FieldError{Field: "name", Constraint: types.ConstraintRequired, Message: "field is required"})
+		}
+		patch.Name = &name
+	}
+	if patch.Fields != nil && len(patch.Fields) == 0 {
+		errs = append(errs, types.FieldError{Field: "fields", Constraint: types.ConstraintRequired, Message: "form has to have at least one field"})
+	}
+	if len(errs) > 0 {
+		return types.FormData{}, errs
+	}
+
+	if _, err := s.models.Forms.Update(userID, formID, patch); err != nil {
+		return types.FormData{}, err
+	}
+
+	return s.models.Forms.Get(formID)
+}
+
+func (s *Services) GetFormFromRequest(r *http.Request, ctx context.Context) (types.FormData, error) {
+	if err := r.ParseForm(); err != nil {
+		return types.FormData{}, err
+	}
+
+	var err error
 	formData := types.FormData{
-		UserID:      userID,
 		Name:        r.FormValue("name"),
 		Description: r.FormValue("description"),
+		Settings: types.FormSettings{
+			SuccessMessage:   r.FormValue("success_message"),
+			SuccessRedirect:  r.FormValue("success_redirect"),
+			Honeypots:        r.Form["honeypot"],
+			TokenPolicy:      r.FormValue("token_policy"),
+			IPMode:           r.FormValue("ip_mode"),
+			UnexpectedFields: r.FormValue("unexpected_fields"),
+		},
+	}
+
+	if v := r.FormValue("notify"); v != "" {
+		notify, err := types.CoerceValue(v, "bool", nil)
+		if err != nil {
+			return types.FormData{}, fmt.Errorf("invalid notify: %v", err)
+		}
+		formData.Settings.Notify = notify.(bool)
+	}
+	for _, addr := range r.Form["notify_email"] {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			formData.Settings.NotifyEmails = append(formData.Settings.NotifyEmails, addr)
+		}
+	}
+
+	for name, dst := range map[string]**types.RateLimit{
+		"rate_limit_form":    &formData.Settings.RateLimits.PerForm,
+		"rate_limit_ip_form": &formData.Settings.RateLimits.PerIPForm,
+	} {
+		if v := r.FormValue(name); v != "" {
+			rl, err := types.ParseRateLimit(v)
+			if err != nil {
+				return types.FormData{}, err
+			}
+			*dst = &rl
+		}
+	}
+
+	for name, dst := range map[string]*int{
+		"min_fill_seconds":      &formData.Settings.MinFillSeconds,
+		"max_token_age_seconds": &formData.Settings.MaxTokenAgeSeconds,
+	} {
+		if v := r.FormValue(name); v != "" {
+			if *dst, err = strconv.Atoi(v); err != nil {
+				return types.FormData{}, fmt.Errorf("invalid %s: %v", name, err)
+			}
+		}
 	}
 
 	fieldNames := r.Form["field_name"]
 	fieldTypes := r.Form["field_type"]
 	fieldConstraintsString := r.Form["field_constraints"]
+	// Rules are optional, but when sent there has to be one entry per field.
+	fieldRulesString := r.Form["field_rules"]
 
 	if len(fieldNames) == 0 || len(fieldNames) != len(fieldTypes) || len(fieldNames) != len(fieldConstraintsString) {
 		return types.FormData{}, fmt.Errorf("invalid fields data")
 	}
+	if len(fieldRulesString) != 0 && len(fieldRulesString) != len(fieldNames) {
+		return types.FormData{}, fmt.Errorf("invalid fields data")
+	}
 
 	for i := range fieldNames {
 		var fieldConstraints []types.FieldConstraint
@@ -60,12 +168,28 @@ func (s *Services) GetFormFromRequest(r *http.Request, ctx context.Context) (typ
 			return types.FormData{}, err
 		}
 
+		var fieldRules []types.FieldRule
+		if len(fieldRulesString) != 0 && fieldRulesString[i] != "" {
+			err = json.Unmarshal([]byte(fieldRulesString[i]), &fieldRules)
+			if err != nil {
+				return types.FormData{}, err
+			}
+		}
+
 		formData.Fields = append(formData.Fields, types.FormField{
 			Name:        fieldNames[i],
 			Type:        fieldTypes[i],
 			Constraints: fieldConstraints,
+			Rules:       fieldRules,
 		})
 	}
 
+	if err = types.ValidateFormFields(formData.Fields); err != nil {
+		return types.FormData{}, err
+	}
+	if err = types.ValidateFormSettings(formData.Settings, formData.Fields); err != nil {
+		return types.FormData{}, err
+	}
+
 	return formData, nil
 }
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormsCRUD(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	s := &Services{models: m, e: e}
+
+	userID, err := models.InsertTestUser(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	otherID, err := m.Users.Insert("bruno", "bruno@example.com", "tortuga-azul-42")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = s.CreateForm(userID, types.FormData{Name: " "})
+	assert.ErrorAs(t, err, &types.ValidationErrors{})
+
+	form, err := s.CreateForm(userID, types.FormData{
+		Name: "Contacto",
+		Fields: []types.FormField{
+			{Name: "email", Type: "string", Constraints: []types.FieldConstraint{{Name: "email"}}},
+		},
+		Settings: types.FormSettings{SuccessMessage: "Gracias"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, userID, form.UserID)
+	assert.Equal(t, 1, form.FormVersion)
+
+	instanceID, err := m.Forms.GetFormInstanceID(form.ID)
+	assert.NoError(t, err)
+
+	name := "Contacto 2"
+	_, err = s.UserForm(otherID, form.ID)
+	assert.ErrorIs(t, err, models.ErrFormNotFound)
+	_, err = s.PatchForm(otherID, form.ID, types.FormPatch{Name: &name})
+	assert.ErrorIs(t, err, models.ErrFormNotFound)
+
+	form, err = s.PatchForm(userID, form.ID, types.FormPatch{
+		Name:   &name,
+		Fields: []types.FormField{{Name: "correo", Type: "string"}},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, name, form.Name)
+		assert.Equal(t, 2, form.FormVersion)
+		assert.Equal(t, "correo", form.Fields[0].Name)
+		assert.Equal(t, "Gracias", form.Settings.SuccessMessage)
+	}
+
+	// New submissions go to the new instance.
+	newInstanceID, err := m.Forms.GetFormInstanceID(form.ID)
+	assert.NoError(t, err)
+	assert.Greater(t, newInstanceID, instanceID)
+
+	_, err = s.PatchForm(userID, form.ID, types.FormPatch{Fields: []types.FormField{{Name: "x", Type: "nope"}}})
+	assert.ErrorAs(t, err, &types.ValidationErrors{})
+
+	assert.ErrorIs(t, m.Forms.DeleteForm(otherID, form.ID), models.ErrFormNotFound)
+	assert.NoError(t, m.Forms.DeleteForm(userID, form.ID))
+	_, err = s.UserForm(userID, form.ID)
+	assert.ErrorIs(t, err, models.ErrFormNotFound)
+	_, err = m.Forms.GetFormInstanceID(form.ID)
+	assert.ErrorIs(t, err, models.ErrFormNotFound)
+}
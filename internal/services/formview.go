@@ -0,0 +1,263 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"formy.fprzg.net/internal/types"
+)
+
+// FormView is what the public form page needs to render a form: the fields
+// turned into HTML inputs, the values sent so far and the errors they got.
+type FormView struct {
+	ID          int
+	Name        string
+	Description string
+	Action      string
+	Multipart   bool
+	Errors      []string
+	Fields      []FieldView
+	Honeypots   []string
+	// Token is the signed render token sent back with the submission.
+	Token string
+}
+
+type FieldView struct {
+	ID       string
+	Name     string
+	Label    string
+	Input    string
+	Required bool
+	Hidden   bool
+	Multiple bool
+
+	Value   string
+	Values  []string
+	Checked bool
+	Choices []ChoiceView
+
+	Min       string
+	Max       string
+	Step      string
+	MinLength string
+	MaxLength string
+	Pattern   string
+	Accept    string
+
+	Errors []string
+	// Rules is the JSON of the field's conditional rules, evaluated again by
+	// the page script while the form is being filled.
+	Rules string
+}
+
+type ChoiceView struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// textareaMinLength is the strlen max from which string fields are rendered
+// as a textarea instead of a single line input.
+const textareaMinLength = 256
+
+// htmlTimeLayout is the value format of datetime-local inputs.
+const htmlTimeLayout = "2006-01-02T15:04"
+
+// NewFormView builds the view of form, filled with the submitted values and
+// the errors of the last attempt, if any.
+func (s *Services) NewFormView(form types.FormData, values types.SubmissionValues, fieldErrors types.ValidationErrors) FormView {
+	view := FormView{
+		ID:          form.ID,
+		Name:        form.Name,
+		Description: form.Description,
+		Action:      fmt.Sprintf("/f/%d", form.ID),
+		Honeypots:   form.Settings.Honeypots,
+	}
+
+	// The token of a submission that failed validation wasn't used up, and
+	// keeps counting the fill time from when the form was first rendered.
+	token, _ := values.First(types.RenderTokenField).(string)
+	tokenFailed := slices.ContainsFunc(fieldErrors, func(fe types.FieldError) bool {
+		return fe.Field == types.RenderTokenField
+	})
+	if _, problem := s.checkRenderToken(form, token); problem != "" || tokenFailed {
+		var err error
+		token, err = s.NewRenderToken(form.ID)
+		if err != nil {
+			s.e.Logger.Printf("NewFormView: failed to create render token: %v\n", err)
+		}
+	}
+	view.Token = token
+
+	errorsByField := make(map[string][]string)
+	for _, fe := range fieldErrors {
+		if form.GetFieldIndex(fe.Field) == -1 {
+			view.Errors = append(view.Errors, fe.Message)
+			continue
+		}
+		errorsByField[fe.Field] = append(errorsByField[fe.Field], fe.Message)
+	}
+
+	states := types.EvaluateFieldRules(form.Fields, values, s.timeLayouts)
+	for _, field := range form.Fields {
+		fv := newFieldView(field, values[field.Name])
+		fv.Hidden = !states[field.Name].Visible
+		fv.Errors = errorsByField[field.Name]
+
+		if len(field.Rules) > 0 {
+			if buf, err := json.Marshal(field.Rules); err == nil {
+				fv.Rules = string(buf)
+			}
+		}
+
+		if field.Type == types.FieldTypeFile {
+			view.Multipart = true
+		}
+
+		view.Fields = append(view.Fields, fv)
+	}
+
+	return view
+}
+
+func newFieldView(field types.FormField, submitted []interface{}) FieldView {
+	fv := FieldView{
+		ID:    "field-" + field.Name,
+		Name:  field.Name,
+		Label: fieldLabel(field.Name),
+		Input: "text",
+	}
+
+	var strValues []string
+	for _, v := range submitted {
+		if !types.IsEmptyValue(v) {
+			strValues = append(strValues, fmt.Sprint(v))
+		}
+	}
+	if len(strValues) > 0 {
+		fv.Value = strValues[0]
+	}
+
+	elemType, isList := types.ListElemType(field.Type)
+	if !isList {
+		elemType = field.Type
+	}
+	fv.Multiple = isList
+
+	switch elemType {
+	case "int", "int64":
+		fv.Input, fv.Step = "number", "1"
+	case "float64":
+		fv.Input, fv.Step = "number", "any"
+	case "bool":
+		fv.Input = "checkbox"
+		if b, err := types.CoerceValue(fv.Value, "bool", nil); err == nil {
+			fv.Checked = b.(bool)
+		}
+	case "time.Time":
+		fv.Input = "datetime-local"
+	case types.FieldTypeFile:
+		fv.Input = "file"
+		fv.Value = ""
+	}
+
+	for _, c := range field.Constraints {
+		switch c.Name {
+		case types.ConstraintRequired:
+			fv.Required = true
+		case types.ConstraintEmail:
+			fv.Input = "email"
+		case types.ConstraintURL:
+			fv.Input = "url"
+		case types.ConstraintPhone:
+			fv.Input = "tel"
+		case types.ConstraintPattern:
+			fv.Pattern = c.Pattern
+		case types.ConstraintStrlen:
+			fv.MinLength, fv.MaxLength = boundString(c.Min), boundString(c.Max)
+			if max, ok := boundInt(c.Max); ok && max >= textareaMinLength {
+				fv.Input = "textarea"
+			}
+		case types.ConstraintInterval:
+			if elemType == "time.Time" {
+				fv.Min, fv.Max = timeBoundString(c.Min), timeBoundString(c.Max)
+			} else if fv.Input == "number" {
+				fv.Min, fv.Max = boundString(c.Min), boundString(c.Max)
+			}
+		case types.ConstraintMime:
+			fv.Accept = strings.Join(c.Values, ",")
+		case types.ConstraintMaxCount:
+			if max, ok := boundInt(c.Max); ok && max > 1 {
+				fv.Multiple = true
+			}
+		}
+	}
+
+	if choices := field.Choices(); len(choices) > 0 {
+		fv.Input = "select"
+		if isList {
+			fv.Input = "checkboxes"
+		}
+		for _, choice := range choices {
+			fv.Choices = append(fv.Choices, ChoiceView{
+				Value:    choice.Value,
+				Label:    choice.DisplayLabel(),
+				Selected: slices.Contains(strValues, choice.Value),
+			})
+		}
+	} else if isList {
+		// One input per value sent so far plus an empty one to add more.
+		fv.Values = append(strValues, "")
+	}
+
+	if elemType == "time.Time" {
+		if t, ok := types.ParseTime(fv.Value, nil); ok {
+			fv.Value = t.Format(htmlTimeLayout)
+		}
+	}
+
+	return fv
+}
+
+// fieldLabel turns a field name such as "company_name" into "Company name".
+func fieldLabel(name string) string {
+	label := strings.TrimSpace(strings.NewReplacer("_", " ", "-", " ").Replace(name))
+	if label == "" {
+		return name
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+func boundString(bound interface{}) string {
+	if bound == nil {
+		return ""
+	}
+	return fmt.Sprint(bound)
+}
+
+func timeBoundString(bound interface{}) string {
+	switch b := bound.(type) {
+	case time.Time:
+		return b.Format(htmlTimeLayout)
+	case string:
+		if t, ok := types.ParseTime(b, nil); ok {
+			return t.Format(htmlTimeLayout)
+		}
+	}
+	return ""
+}
+
+func boundInt(bound interface{}) (int, bool) {
+	switch b := bound.(type) {
+	case int:
+		return b, true
+	case int64:
+		return int(b), true
+	case float64:
+		return int(b), true
+	}
+	return 0, false
+}
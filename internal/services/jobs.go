@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DefaultJobWorkers is used when the config doesn't set how many jobs
+	// run at the same time.
+	DefaultJobWorkers = 2
+	// jobPollInterval is how often idle workers look for due jobs, e.g.
+	// retries, besides being woken up by new ones.
+	jobPollInterval = time.Second
+	// jobTimeout bounds a single run of a job.
+	jobTimeout = time.Minute
+
+	jobBackoffBase = 30 * time.Second
+	jobBackoffMax  = time.Hour
+)
+
+// JobHandler runs a job. Returning an error schedules a retry, until the job
+// runs out of attempts and is moved to the dead letters.
+type JobHandler func(ctx context.Context, job types.Job) error
+
+// JobQueue runs the jobs stored in the jobs table with a pool of workers.
+// Jobs are claimed one at a time, so every job runs at most once at a time
+// even with several workers.
+type JobQueue struct {
+	jobs     models.JobsModelInterface
+	handlers map[string]JobHandler
+	workers  int
+	e        *echo.Echo
+
+	wake    chan struct{}
+	stop    chan struct{}
+	running sync.WaitGroup
+	// ctx is cancelled when draining times out, to abort the running jobs.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewJobQueue(jobs models.JobsModelInterface, workers int, e *echo.Echo) *JobQueue {
+	if workers <= 0 {
+		workers = DefaultJobWorkers
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JobQueue{
+		jobs:     jobs,
+		handlers: make(map[string]JobHandler),
+		workers:  workers,
+		e:        e,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Handle registers the handler of the jobs of kind. It has to be called
+// before Start.
+func (q *JobQueue) Handle(kind string, handler JobHandler) {
+	q.handlers[kind] = handler
+}
+
+// Enqueue stores a job to run as soon as a worker is free.
+func (q *JobQueue) Enqueue(kind string, payload any) (int, error) {
+	id, err := q.jobs.Enqueue(kind, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	q.Wake()
+	return id, nil
+}
+
+// Wake tells the workers there are new jobs, e.g. after enqueueing them in
+// another transaction.
+func (q *JobQueue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start requeues the jobs a previous run left unfinished and starts the
+// workers.
+func (q *JobQueue) Start() error {
+	requeued, err := q.jobs.RequeueRunning()
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		q.e.Logger.Printf("[jobs] Requeued %d unfinished jobs.\n", requeued)
+	}
+
+	for i := 0; i < q.workers; i++ {
+		q.running.Add(1)
+		go q.work()
+	}
+	return nil
+}
+
+// Shutdown stops claiming jobs and waits for the running ones to finish.
+// If ctx ends first they are cancelled and retried later like any failed
+// job. Pending jobs stay in the table for the next Start.
+func (q *JobQueue) Shutdown(ctx context.Context) error {
+	close(q.stop)
+
+	done := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (q *JobQueue) work() {
+	defer q.running.Done()
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Run every due job before waiting again.
+		for q.runNext() {
+			select {
+			case <-q.stop:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext claims and runs a job. It returns false when there was nothing to
+// run.
+func (q *JobQueue) runNext() bool {
+	job, err := q.jobs.Claim()
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			q.e.Logger.Printf("[jobs] Failed to claim a job: %v\n", err)
+		}
+		return false
+	}
+
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		// Retrying won't help, so it goes straight to the dead letters.
+		q.e.Logger.Printf("[jobs] No handler for %s job %d.\n", job.Kind, job.ID)
+		if err = q.jobs.Bury(job.ID, fmt.Sprintf("no handler for jobs of kind '%s'", job.Kind)); err != nil {
+			q.e.Logger.Printf("[jobs] Failed to update job %d: %v\n", job.ID, err)
+		}
+		return true
+	}
+
+	err = q.run(handler, job)
+	switch {
+	case err == nil:
+		err = q.jobs.Complete(job.ID)
+
+	case job.Attempts >= job.MaxAttempts:
+		q.e.Logger.Printf("[jobs] %s job %d failed for the last time: %v\n", job.Kind, job.ID, err)
+		err = q.jobs.Bury(job.ID, err.Error())
+
+	default:
+		delay := JobBackoff(job.Attempts)
+		q.e.Logger.Printf("[jobs] %s job %d failed, retrying in %s: %v\n", job.Kind, job.ID, delay, err)
+		err = q.jobs.Retry(job.ID, time.Now().Add(delay), err.Error())
+	}
+	if err != nil {
+		q.e.Logger.Printf("[jobs] Failed to update job %d: %v\n", job.ID, err)
+	}
+
+	return true
+}
+
+func (q *JobQueue) run(handler JobHandler, job types.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(q.ctx, jobTimeout)
+	defer cancel()
+
+	return handler(ctx, job)
+}
+
+// JobBackoff is how long a job waits before running again after its
+// attempts-th run failed. It doubles with every attempt, up to an hour.
+func JobBackoff(attempts int) time.Duration {
+	delay := jobBackoffBase
+	for i := 1; i < attempts && delay < jobBackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, jobBackoffMax)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: 30 * time.Second},
+		{attempts: 2, expected: time.Minute},
+		{attempts: 4, expected: 4 * time.Minute},
+		{attempts: 8, expected: time.Hour},
+		{attempts: 100, expected: time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, JobBackoff(tt.attempts), "attempts: %d", tt.attempts)
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	q := NewJobQueue(m.Jobs, 1, e)
+	runs := make(map[string]int)
+	q.Handle("ok", func(ctx context.Context, job types.Job) error {
+		runs["ok"]++
+		return nil
+	})
+	q.Handle("fail", func(ctx context.Context, job types.Job) error {
+		runs["fail"]++
+		return errors.New("mail server down")
+	})
+	q.Handle("panic", func(ctx context.Context, job types.Job) error {
+		panic("oops")
+	})
+
+	// makeDue moves the retries to now instead of waiting for the backoff.
+	makeDue := func() {
+		_, err := db.Exec(`UPDATE jobs SET run_at = CURRENT_TIMESTAMP WHERE status = 'pending'`)
+		assert.NoError(t, err)
+	}
+
+	t.Run("Completed jobs are removed", func(t *testing.T) {
+		_, err := m.Jobs.Enqueue("ok", types.SubmissionJob{SubmissionID: 1})
+		assert.NoError(t, err)
+
+		assert.True(t, q.runNext())
+		assert.False(t, q.runNext())
+		assert.Equal(t, 1, runs["ok"])
+
+		pending, err := m.Jobs.GetByStatus(types.JobStatusPending)
+		assert.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+
+	t.Run("Failed jobs are retried later", func(t *testing.T) {
+		_, err := m.Jobs.Enqueue("fail", types.SubmissionJob{SubmissionID: 2})
+		assert.NoError(t, err)
+
+		assert.True(t, q.runNext())
+		// The retry isn't due yet.
+		assert.False(t, q.runNext())
+
+		pending, err := m.Jobs.GetByStatus(types.JobStatusPending)
+		assert.NoError(t, err)
+		if assert.Len(t, pending, 1) {
+			assert.Equal(t, 1, pending[0].Attempts)
+			assert.Equal(t, "mail server down", pending[0].LastError)
+		}
+	})
+
+	t.Run("Jobs out of attempts are dead", func(t *testing.T) {
+		for i := 1; i < models.DefaultJobMaxAttempts; i++ {
+			makeDue()
+			assert.True(t, q.runNext())
+		}
+		assert.Equal(t, models.DefaultJobMaxAttempts, runs["fail"])
+
+		makeDue()
+		assert.False(t, q.runNext())
+
+		dead, err := m.Jobs.GetByStatus(types.JobStatusDead)
+		assert.NoError(t, err)
+		if assert.Len(t, dead, 1) {
+			assert.Equal(t, "fail", dead[0].Kind)
+			assert.JSONEq(t, `{"submission_id": 2}`, string(dead[0].Payload))
+		}
+	})
+
+	t.Run("Unknown kinds are dead at once", func(t *testing.T) {
+		_, err := m.Jobs.Enqueue("export", types.SubmissionJob{SubmissionID: 3})
+		assert.NoError(t, err)
+
+		assert.True(t, q.runNext())
+
+		dead, err := m.Jobs.GetByStatus(types.JobStatusDead)
+		assert.NoError(t, err)
+		assert.Len(t, dead, 2)
+	})
+
+	t.Run("Panics count as failures", func(t *testing.T) {
+		_, err := m.Jobs.Enqueue("panic", types.SubmissionJob{SubmissionID: 4})
+		assert.NoError(t, err)
+
+		assert.True(t, q.runNext())
+
+		pending, err := m.Jobs.GetByStatus(types.JobStatusPending)
+		assert.NoError(t, err)
+		if assert.Len(t, pending, 1) {
+			assert.Equal(t, "job panicked: oops", pending[0].LastError)
+		}
+	})
+}
+
+func TestJobQueueDrain(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	// A job left running by a previous process is run again on Start.
+	_, err = m.Jobs.Enqueue("slow", nil)
+	assert.NoError(t, err)
+	_, err = m.Jobs.Claim()
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q := NewJobQueue(m.Jobs, 2, e)
+	q.Handle("slow", func(ctx context.Context, job types.Job) error {
+		close(started)
+		<-release
+		return nil
+	})
+	assert.NoError(t, q.Start())
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the requeued job didn't run")
+	}
+
+	shutdown := make(chan error)
+	go func() { shutdown <- q.Shutdown(context.Background()) }()
+
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown didn't wait for the running job")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	assert.NoError(t, <-shutdown)
+
+	for _, status := range []string{types.JobStatusPending, types.JobStatusRunning} {
+		jobs, err := m.Jobs.GetByStatus(status)
+		assert.NoError(t, err)
+		assert.Empty(t, jobs, status)
+	}
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"formy.fprzg.net/internal/types"
+	"github.com/labstack/echo/v4"
+)
+
+// smtpTimeout bounds a whole SMTP conversation, so a stuck server can't hold
+// a notification forever.
+const smtpTimeout = 30 * time.Second
+
+// Message is an email with a plain text and an HTML version of its body.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends emails. SMTPMailer is used in production and FileMailer
+// while developing.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewMailer returns the mailer described by cfg.
+func NewMailer(cfg types.MailConfig, e *echo.Echo) Mailer {
+	if cfg.SMTPHost != "" {
+		return NewSMTPMailer(cfg)
+	}
+	return NewFileMailer(cfg.Dir, e)
+}
+
+// Bytes encodes msg as a multipart/alternative MIME message.
+func (msg Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	messageID, err := newMessageID(msg.From)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := []struct{ name, value string }{
+		{"From", msg.From},
+		{"To", strings.Join(msg.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", mw.Boundary())},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.name, h.value)
+	}
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if part.body == "" {
+			continue
+		}
+
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newMessageID(from string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = d
+		}
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
+
+// SMTPMailer sends emails through an SMTP server, upgrading the connection
+// with STARTTLS when the server supports it.
+type SMTPMailer struct {
+	host     string
+	addr     string
+	username string
+	password string
+}
+
+func NewSMTPMailer(cfg types.MailConfig) *SMTPMailer {
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+
+	return &SMTPMailer{
+		host:     cfg.SMTPHost,
+		addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port)),
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+	}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid sender: %v", err)
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", m.addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// FileMailer writes every email to an .eml file in dir, or only logs it when
+// dir is empty. It's meant for development.
+type FileMailer struct {
+	dir string
+	e   *echo.Echo
+}
+
+func NewFileMailer(dir string, e *echo.Echo) *FileMailer {
+	return &FileMailer{dir: dir, e: e}
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if m.dir == "" {
+		m.e.Logger.Printf("[mailer] To: %s; Subject: %s\n%s\n", strings.Join(msg.To, ", "), msg.Subject, msg.Text)
+		return nil
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := filepath.Join(m.dir, fmt.Sprintf("%s.eml", time.Now().UTC().Format("20060102T150405.000000000")))
+	if err := os.WriteFile(name, body, 0o644); err != nil {
+		return err
+	}
+
+	m.e.Logger.Printf("[mailer] To: %s; Subject: %s; written to %s\n", strings.Join(msg.To, ", "), msg.Subject, name)
+	return nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/types"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := Message{
+		From:    "Formy <no-reply@formy.fprzg.net>",
+		To:      []string{"sales@example.com", "ops@example.com"},
+		Subject: "Nuevo envío en Contacto",
+		Text:    "Hola, ¿qué tal?\n",
+		HTML:    "<p>Hola, ¿qué tal?</p>",
+	}
+
+	raw, err := msg.Bytes()
+	assert.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	assert.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, msg.Subject, subject)
+	assert.Equal(t, "sales@example.com, ops@example.com", parsed.Header.Get("To"))
+	assert.True(t, strings.HasSuffix(parsed.Header.Get("Message-ID"), "@formy.fprzg.net>"))
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	var parts []string
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+
+		// The reader undoes the quoted-printable encoding, which leaves line
+		// breaks as CRLF.
+		body, err := io.ReadAll(part)
+		assert.NoError(t, err)
+		parts = append(parts, part.Header.Get("Content-Type")+": "+string(body))
+	}
+
+	assert.Equal(t, []string{
+		"text/plain; charset=utf-8: Hola, ¿qué tal?\r\n",
+		"text/html; charset=utf-8: <p>Hola, ¿qué tal?</p>",
+	}, parts)
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewFileMailer(dir, echo.New())
+
+	err := mailer.Send(Message{From: "no-reply@example.com", To: []string{"sales@example.com"}, Subject: "Hi", Text: "Hello\n"})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		content, err := os.ReadFile(files[0])
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), "Subject: Hi\r\n")
+	}
+}
+
+func TestSubmissionEmailTemplate(t *testing.T) {
+	tm, err := NewTemplateManager(false, echo.New())
+	assert.NoError(t, err)
+
+	msg, err := tm.ExecuteEmail("submissions-new.tmpl.html", NewSubmissionEmail{
+		Form: types.FormData{ID: 1, Name: "Contacto"},
+		Submission: types.SubmissionData{
+			ID:               7,
+			Fields:           []types.SubmissionField{{Name: "message", ContentAsString: "<b>Hola</b>"}},
+			UnexpectedFields: []types.UnexpectedField{{Name: "utm", Content: "ads"}},
+		},
+		ReceivedAt: time.Date(2024, 4, 8, 10, 30, 0, 0, time.UTC),
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Nuevo envío en Contacto", msg.Subject)
+	assert.Contains(t, msg.Text, "message: <b>Hola</b>")
+	assert.Contains(t, msg.Text, "utm: ads")
+	assert.Contains(t, msg.HTML, "&lt;b&gt;Hola&lt;/b&gt;")
+	assert.NotContains(t, msg.HTML, "<b>Hola</b>")
+}
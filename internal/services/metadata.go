@@ -0,0 +1,80 @@
+package services
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"formy.fprzg.net/internal/types"
+	"github.com/labstack/echo/v4"
+)
+
+// maxMetadataValueLength caps every header copied into the metadata, so
+// clients can't make submissions arbitrarily large through them.
+const maxMetadataValueLength = 512
+
+// RequestMetadata collects the metadata of a submission to form sent with r.
+// The client IP comes from the server's IP extractor, which only trusts
+// X-Forwarded-For from the configured proxies.
+func (s *Services) RequestMetadata(form types.FormData, r *http.Request) types.SubmissionMetadata {
+	md := types.SubmissionMetadata{
+		IPAddress:      s.formIP(form, s.clientIP(r)),
+		UserAgent:      truncateString(r.UserAgent(), maxMetadataValueLength),
+		Referer:        truncateString(r.Referer(), maxMetadataValueLength),
+		Origin:         truncateString(r.Header.Get("Origin"), maxMetadataValueLength),
+		AcceptLanguage: truncateString(r.Header.Get("Accept-Language"), maxMetadataValueLength),
+	}
+
+	// Campaign parameters are taken from the submission URL and, failing
+	// that, from the page the form was on.
+	queries := []url.Values{r.URL.Query()}
+	if referer, err := url.Parse(r.Referer()); err == nil {
+		queries = append(queries, referer.Query())
+	}
+	for _, param := range types.UTMParams {
+		for _, query := range queries {
+			if v := query.Get(param); v != "" {
+				if md.UTM == nil {
+					md.UTM = make(map[string]string)
+				}
+				md.UTM[param] = truncateString(v, maxMetadataValueLength)
+				break
+			}
+		}
+	}
+
+	return md
+}
+
+func (s *Services) clientIP(r *http.Request) string {
+	extract := s.e.IPExtractor
+	if extract == nil {
+		extract = echo.ExtractIPDirect()
+	}
+	return extract(r)
+}
+
+// formIP returns ip the way form keeps it. Hashes are keyed with the server
+// secret, so they can be compared with each other but not reversed by
+// hashing every address.
+func (s *Services) formIP(form types.FormData, ip string) string {
+	switch form.Settings.IPMode {
+	case types.IPModeTruncated:
+		return types.TruncateIP(ip)
+	case types.IPModeHashed:
+		if ip == "" {
+			return ""
+		}
+		return hex.EncodeToString(s.ipHashes.mac(ip))
+	}
+	return ip
+}
+
+// truncateString cuts v to at most n bytes without splitting a character.
+func truncateString(v string, n int) string {
+	if len(v) <= n {
+		return v
+	}
+	return strings.ToValidUTF8(v[:n], "")
+}
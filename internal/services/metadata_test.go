@@ -0,0 +1,67 @@
+package services
+
+import (
+	"encoding/hex"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"formy.fprzg.net/internal/types"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestMetadata(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	direct := echo.New()
+	proxied := echo.New()
+	proxied.IPExtractor = echo.ExtractIPFromXFFHeader(echo.TrustPrivateNet(false), echo.TrustIPRange(proxies))
+
+	hashes := NewSigner("secret", "formy ip hash")
+
+	tests := []struct {
+		TestName   string
+		e          *echo.Echo
+		remoteAddr string
+		xff        string
+		ipMode     string
+		expectedIP string
+	}{
+		{TestName: "Peer address", e: direct, remoteAddr: "203.0.113.7:5000", xff: "198.51.100.1", expectedIP: "203.0.113.7"},
+		{TestName: "Trusted proxy", e: proxied, remoteAddr: "10.1.2.3:5000", xff: "198.51.100.1, 10.9.9.9", expectedIP: "198.51.100.1"},
+		{TestName: "Untrusted proxy", e: proxied, remoteAddr: "203.0.113.7:5000", xff: "198.51.100.1", expectedIP: "203.0.113.7"},
+		{TestName: "Truncated", e: direct, remoteAddr: "203.0.113.7:5000", ipMode: types.IPModeTruncated, expectedIP: "203.0.113.0"},
+		{TestName: "Hashed", e: direct, remoteAddr: "203.0.113.7:5000", ipMode: types.IPModeHashed, expectedIP: hex.EncodeToString(hashes.mac("203.0.113.7"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			s := &Services{e: tt.e, ipHashes: hashes}
+			form := types.FormData{Settings: types.FormSettings{IPMode: tt.ipMode}}
+
+			r := httptest.NewRequest("POST", "/f/1", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			assert.Equal(t, tt.expectedIP, s.RequestMetadata(form, r).IPAddress)
+		})
+	}
+
+	t.Run("Headers and UTM", func(t *testing.T) {
+		s := &Services{e: direct, ipHashes: hashes}
+		r := httptest.NewRequest("POST", "/api/submissions/new/1?utm_source=newsletter", nil)
+		r.Header.Set("User-Agent", "Mozilla/5.0")
+		r.Header.Set("Referer", "https://example.com/contact?utm_source=ads&utm_campaign=spring")
+		r.Header.Set("Origin", "https://example.com")
+		r.Header.Set("Accept-Language", "es-MX,es;q=0.9")
+
+		md := s.RequestMetadata(types.FormData{}, r)
+		assert.Equal(t, "Mozilla/5.0", md.UserAgent)
+		assert.Equal(t, "https://example.com/contact?utm_source=ads&utm_campaign=spring", md.Referer)
+		assert.Equal(t, "https://example.com", md.Origin)
+		assert.Equal(t, "es-MX,es;q=0.9", md.AcceptLanguage)
+		assert.Equal(t, map[string]string{"utm_source": "newsletter", "utm_campaign": "spring"}, md.UTM)
+	})
+}
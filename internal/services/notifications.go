@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+)
+
+// JobNotifySubmission emails the form's recipients about a new submission.
+// Its payload is a types.SubmissionJob.
+const JobNotifySubmission = "notify_submission"
+
+// NewSubmissionEmail is the data of the submissions-new email template.
+type NewSubmissionEmail struct {
+	Form       types.FormData
+	Submission types.SubmissionData
+	ReceivedAt time.Time
+}
+
+// handleNotifySubmission runs JobNotifySubmission jobs. Submissions deleted
+// or forms that stopped notifying since the job was enqueued are skipped.
+func (s *Services) handleNotifySubmission(ctx context.Context, job types.Job) error {
+	var payload types.SubmissionJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	submission, err := s.models.Submissions.GetData(payload.SubmissionID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	form, err := s.models.Forms.Get(submission.FormID)
+	if err != nil {
+		if errors.Is(err, models.ErrFormNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !form.Settings.Notify || submission.Status != types.SubmissionStatusAccepted {
+		return nil
+	}
+
+	return s.sendSubmissionEmail(form, submission)
+}
+
+func (s *Services) sendSubmissionEmail(form types.FormData, submission types.SubmissionData) error {
+	// submitted_at is stored by SQLite's CURRENT_TIMESTAMP, in UTC.
+	receivedAt, err := time.Parse(time.DateTime, submission.SubmittedAt)
+	if err != nil {
+		receivedAt = time.Now()
+	}
+
+	msg, err := s.TemplateManager.ExecuteEmail("submissions-new.tmpl.html", NewSubmissionEmail{
+		Form:       form,
+		Submission: submission,
+		ReceivedAt: receivedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.From = s.mailSender
+	msg.To = form.Settings.NotifyEmails
+	return s.mailer.Send(msg)
+}
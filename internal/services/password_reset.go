@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+)
+
+// JobSendPasswordReset emails a user a link to set a new password. Its
+// payload is a types.UserJob. The token is created by the job so it's never
+// stored in the clear, not even in the queue.
+const JobSendPasswordReset = "send_password_reset"
+
+// PasswordResetTokenMaxAge is how long the link of a reset email works.
+const PasswordResetTokenMaxAge = time.Hour
+
+// passwordResetLimit bounds the reset emails sent to a user.
+var passwordResetLimit = types.RateLimit{PerMinute: 0.2, Burst: 2}
+
+var ErrInvalidPasswordResetToken = errors.New("services: invalid or expired password reset link")
+
+// PasswordResetEmail is the data of the users-password-reset email template.
+type PasswordResetEmail struct {
+	UserName  string
+	Link      string
+	ExpiresIn time.Duration
+}
+
+// RequestPasswordReset queues a reset email for the user with login as user
+// name or email. Like ResendVerification, it doesn't tell whether there's
+// such a user.
+func (s *Services) RequestPasswordReset(login string) error {
+	login = strings.TrimSpace(login)
+
+	var userID int
+	var err error
+	if strings.Contains(login, "@") {
+		userID, err = s.models.Users.GetIDByEmail(strings.ToLower(login))
+	} else {
+		userID, err = s.models.Users.GetIDByUserName(login)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	if ok, _ := s.rateLimiter.Allow(RateCheck{Key: fmt.Sprintf("reset:%d", userID), Limit: passwordResetLimit}); !ok {
+		return nil
+	}
+
+	_, err = s.Jobs.Enqueue(JobSendPasswordReset, types.UserJob{UserID: userID})
+	return err
+}
+
+// PasswordResetUser returns the user a reset token is for, or
+// ErrInvalidPasswordResetToken if it can't be used.
+func (s *Services) PasswordResetUser(token string) (models.User, error) {
+	userID, err := s.models.PasswordResets.GetUserID(hashToken(token))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return models.User{}, ErrInvalidPasswordResetToken
+		}
+		return models.User{}, err
+	}
+
+	return s.models.Users.Get(userID)
+}
+
+// ResetPassword sets the password of a reset token's user. Weak passwords
+// are returned as types.ValidationErrors.
+func (s *Services) ResetPassword(token, password, confirmation string) error {
+	user, err := s.PasswordResetUser(token)
+	if err != nil {
+		return err
+	}
+
+	if msg := types.CheckPassword(password, user.UserName); msg != "" {
+		return types.ValidationErrors{{Field: "password", Constraint: "password", Message: msg}}
+	}
+	if password != confirmation {
+		return types.ValidationErrors{{Field: "password_confirmation", Constraint: "password", Message: "passwords don't match"}}
+	}
+
+	userID, err := s.models.PasswordResets.Reset(hashToken(token), password)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return ErrInvalidPasswordResetToken
+		}
+		return err
+	}
+
+	s.tokenVersions.forget(userID)
+	return nil
+}
+
+func (s *Services) handleSendPasswordReset(ctx context.Context, job types.Job) error {
+	var payload types.UserJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	user, err := s.models.Users.Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+	if user.Email == "" {
+		return nil
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.models.PasswordResets.Insert(payload.UserID, hashToken(token), time.Now().Add(PasswordResetTokenMaxAge))
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.TemplateManager.ExecuteEmail("users-password-reset.tmpl.html", PasswordResetEmail{
+		UserName:  user.UserName,
+		Link:      s.baseURL + "/users/password/reset?token=" + url.QueryEscape(token),
+		ExpiresIn: PasswordResetTokenMaxAge,
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.From = s.mailSender
+	msg.To = []string{user.Email}
+	return s.mailer.Send(msg)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordReset(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	tm, err := NewTemplateManager(false, e)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	mailer := &recordingMailer{}
+	s := &Services{
+		models:          m,
+		e:               e,
+		baseURL:         "https://formy.example.com",
+		rateLimiter:     NewRateLimiter(0),
+		tokenVersions:   newTokenVersionCache(time.Minute),
+		mailer:          mailer,
+		TemplateManager: tm,
+		Jobs:            NewJobQueue(m.Jobs, 1, e),
+	}
+	s.Jobs.Handle(JobSendPasswordReset, s.handleSendPasswordReset)
+
+	userID, err := models.InsertTestUser(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Both the user name and the email find the account.
+	assert.NoError(t, s.RequestPasswordReset(models.ValidUserName))
+	assert.NoError(t, s.RequestPasswordReset(" ALICE@example.com"))
+	assert.NoError(t, s.RequestPasswordReset("nobody"))
+	for s.Jobs.runNext() {
+	}
+	if !assert.Len(t, mailer.sent, 2) {
+		return
+	}
+
+	tokens := make([]string, 0, 2)
+	for _, msg := range mailer.sent {
+		assert.Equal(t, []string{models.ValidUserEmail}, msg.To)
+		link := regexp.MustCompile(`https://formy\.example\.com/users/password/reset\?token=\S+`).FindString(msg.Text)
+		u, err := url.Parse(link)
+		if assert.NoError(t, err) {
+			tokens = append(tokens, u.Query().Get("token"))
+		}
+	}
+
+	// Only the last link sent works, so retried or repeated emails don't
+	// leave more valid tokens around.
+	_, err = s.PasswordResetUser(tokens[0])
+	assert.ErrorIs(t, err, ErrInvalidPasswordResetToken)
+
+	var pending int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM password_resets WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&pending))
+	assert.Equal(t, 1, pending)
+
+	user, err := s.PasswordResetUser(tokens[1])
+	assert.NoError(t, err)
+	assert.Equal(t, models.ValidUserName, user.UserName)
+
+	_, err = s.PasswordResetUser("made-up")
+	assert.ErrorIs(t, err, ErrInvalidPasswordResetToken)
+
+	err = s.ResetPassword(tokens[1], "short", "short")
+	assert.ErrorAs(t, err, &types.ValidationErrors{})
+
+	err = s.ResetPassword(tokens[1], "tortuga-azul-42", "tortuga-azul-43")
+	assert.ErrorAs(t, err, &types.ValidationErrors{})
+
+	var version int
+	assert.NoError(t, db.QueryRow(`SELECT token_version FROM users WHERE id = ?`, userID).Scan(&version))
+
+	assert.NoError(t, s.ResetPassword(tokens[1], "tortuga-azul-42", "tortuga-azul-42"))
+
+	_, err = m.Users.Authenticate(models.ValidUserName, "tortuga-azul-42")
+	assert.NoError(t, err)
+	_, err = m.Users.Authenticate(models.ValidUserName, models.ValidUserPassword)
+	assert.ErrorIs(t, err, models.ErrInvalidCredentials)
+
+	var newVersion int
+	assert.NoError(t, db.QueryRow(`SELECT token_version FROM users WHERE id = ?`, userID).Scan(&newVersion))
+	assert.Equal(t, version+1, newVersion)
+
+	// Tokens work once.
+	for _, token := range tokens {
+		assert.ErrorIs(t, s.ResetPassword(token, "otra-clave-99", "otra-clave-99"), ErrInvalidPasswordResetToken)
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"regexp"
+	"sync"
+
+	"formy.fprzg.net/internal/types"
+)
+
+// maxCachedFormInstances bounds the pattern cache; it's simply emptied once
+// it grows past this size.
+const maxCachedFormInstances = 1024
+
+// patternCache keeps the compiled "pattern" constraints of every form
+// instance, so the regular expressions aren't compiled on every submission.
+// Form instances are immutable, so entries never go stale.
+type patternCache struct {
+	sync.RWMutex
+	instances map[int]map[string]*regexp.Regexp
+}
+
+func newPatternCache() *patternCache {
+	return &patternCache{
+		instances: make(map[int]map[string]*regexp.Regexp),
+	}
+}
+
+// apply sets the compiled regular expression on every pattern constraint of
+// fields. Patterns that don't compile are left alone; they get reported
+// when the constraint is evaluated.
+func (pc *patternCache) apply(formInstanceID int, fields []types.FormField) {
+	pc.RLock()
+	compiled, ok := pc.instances[formInstanceID]
+	pc.RUnlock()
+
+	if !ok {
+		compiled = make(map[string]*regexp.Regexp)
+		for _, field := range fields {
+			for _, c := range field.Constraints {
+				if c.Name != types.ConstraintPattern {
+					continue
+				}
+				if re, err := types.CompilePattern(c.Pattern); err == nil {
+					compiled[c.Pattern] = re
+				}
+			}
+		}
+
+		pc.Lock()
+		if len(pc.instances) >= maxCachedFormInstances {
+			pc.instances = make(map[int]map[string]*regexp.Regexp)
+		}
+		pc.instances[formInstanceID] = compiled
+		pc.Unlock()
+	}
+
+	for i := range fields {
+		for j := range fields[i].Constraints {
+			c := &fields[i].Constraints[j]
+			if c.Name == types.ConstraintPattern {
+				c.Regexp = compiled[c.Pattern]
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+)
+
+// DefaultRateLimitIdleTimeout is used when the config doesn't set one.
+const DefaultRateLimitIdleTimeout = 10 * time.Minute
+
+// RateLimiter is an in-memory store of token buckets. Buckets that weren't
+// used for the idle timeout are evicted; as long as the timeout is longer
+// than the time a bucket takes to refill, dropping them changes nothing.
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	idle      time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateCheck is a bucket key and the limit that applies to it.
+type RateCheck struct {
+	Key   string
+	Limit types.RateLimit
+}
+
+func NewRateLimiter(idle time.Duration) *RateLimiter {
+	if idle <= 0 {
+		idle = DefaultRateLimitIdleTimeout
+	}
+
+	return &RateLimiter{
+		buckets: make(map[string]*bucket),
+		idle:    idle,
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from every bucket in checks, or from none of them if
+// any is empty. In that case it returns how long to wait before retrying.
+func (rl *RateLimiter) Allow(checks ...RateCheck) (bool, time.Duration) {
+	return rl.take(checks, true)
+}
+
+// Peek reports what Allow would, without taking any token.
+func (rl *RateLimiter) Peek(checks ...RateCheck) (bool, time.Duration) {
+	return rl.take(checks, false)
+}
+
+func (rl *RateLimiter) take(checks []RateCheck, consume bool) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.sweep(now)
+
+	var retryAfter time.Duration
+	buckets := make([]*bucket, len(checks))
+	for i, check := range checks {
+		if check.Limit.PerMinute <= 0 {
+			continue
+		}
+
+		b := rl.refill(check, now)
+		buckets[i] = b
+		if b.tokens < 1 {
+			perSecond := check.Limit.PerMinute / 60
+			wait := time.Duration(math.Ceil((1-b.tokens)/perSecond*1000)) * time.Millisecond
+			retryAfter = max(retryAfter, wait)
+		}
+	}
+
+	if retryAfter > 0 {
+		return false, retryAfter
+	}
+	if !consume {
+		return true, 0
+	}
+
+	for _, b := range buckets {
+		if b != nil {
+			b.tokens--
+		}
+	}
+	return true, 0
+}
+
+func (rl *RateLimiter) refill(check RateCheck, now time.Time) *bucket {
+	burst := float64(max(check.Limit.Burst, 1))
+
+	b, ok := rl.buckets[check.Key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		rl.buckets[check.Key] = b
+	}
+
+	elapsed := now.Sub(b.last).Minutes()
+	b.tokens = math.Min(burst, b.tokens+elapsed*check.Limit.PerMinute)
+	b.last = now
+	return b
+}
+
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.idle {
+		return
+	}
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) > rl.idle {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// CheckSubmissionRate applies the submission limits of ip and formID, with
+// the form's own overrides. It returns how long the client has to wait, or
+// zero if the submission can go ahead.
+func (s *Services) CheckSubmissionRate(ip string, formID int) (time.Duration, error) {
+	limits := s.rateLimits
+	checks := []RateCheck{{Key: "ip:" + ip, Limit: limits.PerIP}}
+
+	// The client's own limit goes first, so a flood from one IP doesn't
+	// cost a database read per request.
+	if ok, retryAfter := s.rateLimiter.Peek(checks...); !ok {
+		return retryAfter, nil
+	}
+
+	// Unknown forms only count against the client, so made up IDs don't
+	// fill the store with buckets.
+	form, err := s.models.Forms.Get(formID)
+	switch {
+	case err == nil:
+		if form.Settings.RateLimits.PerForm != nil {
+			limits.PerForm = *form.Settings.RateLimits.PerForm
+		}
+		if form.Settings.RateLimits.PerIPForm != nil {
+			limits.PerIPForm = *form.Settings.RateLimits.PerIPForm
+		}
+		checks = append(checks,
+			RateCheck{Key: fmt.Sprintf("form:%d", formID), Limit: limits.PerForm},
+			RateCheck{Key: fmt.Sprintf("ip-form:%s:%d", ip, formID), Limit: limits.PerIPForm},
+		)
+	case !errors.Is(err, models.ErrFormNotFound):
+		return 0, err
+	}
+
+	if ok, retryAfter := s.rateLimiter.Allow(checks...); !ok {
+		return retryAfter, nil
+	}
+	return 0, nil
+}
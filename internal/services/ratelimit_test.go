@@ -0,0 +1,92 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 4, 8, 12, 0, 0, 0, time.UTC)
+	rl := NewRateLimiter(time.Minute)
+	rl.now = func() time.Time { return now }
+
+	perIP := RateCheck{Key: "ip:1.2.3.4", Limit: types.RateLimit{PerMinute: 60, Burst: 2}}
+	perForm := RateCheck{Key: "form:1", Limit: types.RateLimit{PerMinute: 6, Burst: 3}}
+
+	ok, _ := rl.Allow(perIP, perForm)
+	assert.True(t, ok, "first request")
+	ok, _ = rl.Allow(perIP, perForm)
+	assert.True(t, ok, "burst")
+
+	ok, retryAfter := rl.Allow(perIP, perForm)
+	assert.False(t, ok, "burst used up")
+	assert.Equal(t, time.Second, retryAfter)
+
+	now = now.Add(time.Second)
+	ok, _ = rl.Allow(perIP, perForm)
+	assert.True(t, ok, "refilled")
+
+	// The form bucket is now empty: a denied request must not take the
+	// token refilled in the IP bucket.
+	now = now.Add(time.Second)
+	ok, retryAfter = rl.Allow(perIP, perForm)
+	assert.False(t, ok, "form limit")
+	assert.Equal(t, 8*time.Second, retryAfter)
+	ok, _ = rl.Allow(perIP)
+	assert.True(t, ok, "ip bucket untouched by denied request")
+
+	now = now.Add(time.Second)
+	ok, _ = rl.Peek(perIP)
+	assert.True(t, ok, "peek")
+	ok, _ = rl.Peek(perIP)
+	assert.True(t, ok, "peek again")
+	ok, _ = rl.Allow(perIP)
+	assert.True(t, ok, "peeking takes no token")
+	ok, retryAfter = rl.Peek(perIP)
+	assert.False(t, ok, "peek empty bucket")
+	assert.Equal(t, time.Second, retryAfter)
+
+	ok, _ = rl.Allow(RateCheck{Key: "ip:5.6.7.8", Limit: types.RateLimit{}})
+	assert.True(t, ok, "disabled limit")
+
+	now = now.Add(2 * time.Minute)
+	rl.Allow()
+	assert.Empty(t, rl.buckets, "idle buckets evicted")
+}
+
+func TestCheckSubmissionRate(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	s := &Services{
+		models:      m,
+		e:           e,
+		rateLimits:  types.RateLimitConfig{PerIP: types.RateLimit{PerMinute: 1, Burst: 1}},
+		rateLimiter: NewRateLimiter(time.Minute),
+	}
+
+	retryAfter, err := s.CheckSubmissionRate("1.2.3.4", 1)
+	assert.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	// Once the client is over its limit, the form isn't even loaded.
+	db.Close()
+	retryAfter, err = s.CheckSubmissionRate("1.2.3.4", 1)
+	assert.NoError(t, err)
+	assert.Greater(t, retryAfter, time.Duration(0))
+
+	_, err = s.CheckSubmissionRate("5.6.7.8", 1)
+	assert.Error(t, err)
+}
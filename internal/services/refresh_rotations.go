@@ -0,0 +1,57 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"formy.fprzg.net/internal/types"
+)
+
+// RefreshGracePeriod is how long after a rotation the old refresh token
+// still gets the token it was rotated into, instead of being taken as
+// reused. Pages firing several requests at once all present the same
+// cookie.
+const RefreshGracePeriod = 5 * time.Second
+
+// refreshRotations remembers the refresh tokens issued by recent rotations,
+// since only their hashes are stored. Rotations are serialized through it,
+// so a concurrent refresh always finds the successor of its token.
+type refreshRotations struct {
+	mu         sync.Mutex
+	successors map[string]rotatedToken
+	now        func() time.Time
+}
+
+type rotatedToken struct {
+	token     types.Token
+	rotatedAt time.Time
+}
+
+func newRefreshRotations() *refreshRotations {
+	return &refreshRotations{
+		successors: make(map[string]rotatedToken),
+		now:        time.Now,
+	}
+}
+
+// successor returns the token tokenHash was rotated into, if that happened
+// less than RefreshGracePeriod ago. The caller holds mu.
+func (rr *refreshRotations) successor(tokenHash string) (types.Token, bool) {
+	rotated, ok := rr.successors[tokenHash]
+	if !ok || rr.now().Sub(rotated.rotatedAt) >= RefreshGracePeriod {
+		return types.Token{}, false
+	}
+	return rotated.token, true
+}
+
+// add records that tokenHash was rotated into token, dropping the rotations
+// too old to be needed. The caller holds mu.
+func (rr *refreshRotations) add(tokenHash string, token types.Token) {
+	now := rr.now()
+	for hash, rotated := range rr.successors {
+		if now.Sub(rotated.rotatedAt) >= RefreshGracePeriod {
+			delete(rr.successors, hash)
+		}
+	}
+	rr.successors[tokenHash] = rotatedToken{token: token, rotatedAt: now}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"formy.fprzg.net/internal/types"
+)
+
+// DefaultRenderTokenMaxAge is used by forms that don't set a maximum age.
+const DefaultRenderTokenMaxAge = 24 * time.Hour
+
+// NewRenderToken returns a signed token recording when form was rendered.
+// Its payload is "<form id>.<unix time>.<nonce>".
+func (s *Services) NewRenderToken(formID int) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	payload := fmt.Sprintf("%d.%d.%s", formID, time.Now().Unix(), base64.RawURLEncoding.EncodeToString(nonce))
+	return s.renderTokens.Sign(payload), nil
+}
+
+// checkRenderToken returns why token isn't acceptable for a submission to
+// form, or an empty string if it is. It doesn't use the token up, so a
+// submission that fails validation can be fixed and sent with it again: that
+// happens when the submission is stored.
+func (s *Services) checkRenderToken(form types.FormData, token string) (types.FormToken, string) {
+	if token == "" {
+		return types.FormToken{}, "missing form token, reload the page and try again"
+	}
+
+	payload, err := s.renderTokens.Verify(token)
+	if err != nil {
+		return types.FormToken{}, "invalid form token"
+	}
+
+	parts := strings.SplitN(payload, ".", 3)
+	if len(parts) != 3 {
+		return types.FormToken{}, "invalid form token"
+	}
+	formID, errID := strconv.Atoi(parts[0])
+	issuedAt, errTime := strconv.ParseInt(parts[1], 10, 64)
+	if errID != nil || errTime != nil || formID != form.ID {
+		return types.FormToken{}, "invalid form token"
+	}
+
+	maxAge := DefaultRenderTokenMaxAge
+	if form.Settings.MaxTokenAgeSeconds > 0 {
+		maxAge = time.Duration(form.Settings.MaxTokenAgeSeconds) * time.Second
+	}
+
+	renderedAt := time.Unix(issuedAt, 0)
+	age := time.Since(renderedAt)
+	if age < time.Duration(form.Settings.MinFillSeconds)*time.Second {
+		return types.FormToken{}, "form submitted too fast"
+	}
+	if age > maxAge {
+		return types.FormToken{}, "form expired, reload the page and try again"
+	}
+
+	return types.FormToken{Nonce: parts[2], FormID: form.ID, ExpiresAt: renderedAt.Add(maxAge)}, ""
+}
+
+// renderTokenError reports problem with the render token of a submission.
+func renderTokenError(problem string) error {
+	return types.ValidationErrors{{
+		Field:      types.RenderTokenField,
+		Constraint: types.ConstraintToken,
+		Message:    problem,
+	}}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTokenSurvivesFailedValidation(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	s := &Services{
+		models:       m,
+		e:            e,
+		timeLayouts:  types.DefaultTimeLayouts,
+		patterns:     newPatternCache(),
+		renderTokens: NewSigner("secret", "formy render token"),
+		ipHashes:     NewSigner("secret", "formy ip hash"),
+	}
+
+	userID, err := models.InsertTestUser(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	form, err := s.CreateForm(userID, types.FormData{
+		Name: "Contacto",
+		Fields: []types.FormField{
+			{Name: "email", Type: "string", Constraints: []types.FieldConstraint{{Name: "required"}, {Name: "email"}}},
+		},
+		Settings: types.FormSettings{TokenPolicy: types.TokenPolicyReject},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	token, err := s.NewRenderToken(form.ID)
+	assert.NoError(t, err)
+
+	submit := func(email string) (types.SubmissionValues, error) {
+		body := url.Values{types.RenderTokenField: {token}, "email": {email}}
+		r := httptest.NewRequest(http.MethodPost, "/f/1", strings.NewReader(body.Encode()))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		_, err := s.ProcessSubmission(form.ID, r, context.Background())
+
+		values, _ := types.SubmissionValuesFromRequest(r, MaxSubmissionMemory)
+		return values, err
+	}
+
+	// Fixing a mistake doesn't need a new token, and the page keeps the
+	// one it was first rendered with.
+	values, err := submit("not an email")
+	if assert.IsType(t, types.ValidationErrors{}, err) {
+		assert.Equal(t, "email", err.(types.ValidationErrors)[0].Field)
+		assert.Equal(t, token, s.NewFormView(form, values, err.(types.ValidationErrors)).Token)
+	}
+
+	// Nor does a submission that couldn't be stored.
+	_, err = db.Exec(`
+		CREATE TRIGGER fail_submission_fields BEFORE INSERT ON submission_fields
+		BEGIN SELECT RAISE(ABORT, 'disk full'); END
+	`)
+	assert.NoError(t, err)
+	_, err = submit("ana@example.com")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, models.ErrFormTokenUsed)
+	_, err = db.Exec(`DROP TRIGGER fail_submission_fields`)
+	assert.NoError(t, err)
+
+	_, err = submit("ana@example.com")
+	assert.NoError(t, err)
+
+	// Once accepted, the token is used up.
+	values, err = submit("ana@example.com")
+	if assert.IsType(t, types.ValidationErrors{}, err) {
+		assert.Equal(t, types.RenderTokenField, err.(types.ValidationErrors)[0].Field)
+		assert.NotEqual(t, token, s.NewFormView(form, values, err.(types.ValidationErrors)).Token)
+	}
+}
+
+func TestReplayedRenderTokenFlagged(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	s := &Services{
+		models:       m,
+		e:            e,
+		timeLayouts:  types.DefaultTimeLayouts,
+		patterns:     newPatternCache(),
+		renderTokens: NewSigner("secret", "formy render token"),
+		ipHashes:     NewSigner("secret", "formy ip hash"),
+	}
+
+	userID, err := models.InsertTestUser(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	form, err := s.CreateForm(userID, types.FormData{
+		Name: "Contacto",
+		Fields: []types.FormField{
+			{Name: "email", Type: "string", Constraints: []types.FieldConstraint{{Name: "unique"}}},
+		},
+		Settings: types.FormSettings{TokenPolicy: types.TokenPolicyFlag},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	token, err := s.NewRenderToken(form.ID)
+	assert.NoError(t, err)
+
+	submit := func(email string) (int, error) {
+		body := url.Values{types.RenderTokenField: {token}, "email": {email}}
+		r := httptest.NewRequest(http.MethodPost, "/f/1", strings.NewReader(body.Encode()))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		return s.ProcessSubmission(form.ID, r, context.Background())
+	}
+
+	first, err := submit("ana@example.com")
+	assert.NoError(t, err)
+	replayed, err := submit("bea@example.com")
+	assert.NoError(t, err)
+
+	data, err := m.Submissions.GetData(first)
+	assert.NoError(t, err)
+	assert.Equal(t, types.SubmissionStatusAccepted, data.Status)
+	data, err = m.Submissions.GetData(replayed)
+	assert.NoError(t, err)
+	assert.Equal(t, types.SubmissionStatusSpam, data.Status)
+
+	// The replay didn't claim its unique value.
+	token, err = s.NewRenderToken(form.ID)
+	assert.NoError(t, err)
+	_, err = submit("bea@example.com")
+	assert.NoError(t, err)
+}
@@ -1,24 +1,77 @@
 package services
 
 import (
+	"net/http"
+	"path/filepath"
+	"strings"
+
 	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
 	"github.com/labstack/echo/v4"
 )
 
 type Services struct {
-	jwtSecret       string
-	models          *models.Models
-	e               *echo.Echo
-	TemplateManager *TemplateManager
+	jwtSecret        string
+	baseURL          string
+	timeLayouts      []string
+	blobs            *BlobStore
+	patterns         *patternCache
+	renderTokens     *Signer
+	ipHashes         *Signer
+	verifyTokens     *Signer
+	tokenVersions    *tokenVersionCache
+	refreshRotations *refreshRotations
+	rateLimits       types.RateLimitConfig
+	rateLimiter      *RateLimiter
+	mailer           Mailer
+	mailSender       string
+	webhookClient    *http.Client
+	Jobs             *JobQueue
+	models           *models.Models
+	e                *echo.Echo
+	TemplateManager  *TemplateManager
 }
 
-func Get(jwtSecret string, m *models.Models, tm *TemplateManager, e *echo.Echo) (*Services, error) {
-	return &Services{
-		jwtSecret:       jwtSecret,
-		models:          m,
-		e:               e,
-		TemplateManager: tm,
-	}, nil
+func Get(cfg types.AppConfig, m *models.Models, tm *TemplateManager, e *echo.Echo) (*Services, error) {
+	timeLayouts := cfg.TimeLayouts
+	if len(timeLayouts) == 0 {
+		timeLayouts = types.DefaultTimeLayouts
+	}
+
+	blobs, err := NewBlobStore(filepath.Join(filepath.Dir(cfg.DBDir), "blobs"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Services{
+		jwtSecret:        cfg.JWTSecret,
+		baseURL:          strings.TrimSuffix(cfg.BaseURL, "/"),
+		timeLayouts:      timeLayouts,
+		blobs:            blobs,
+		patterns:         newPatternCache(),
+		renderTokens:     NewSigner(cfg.JWTSecret, "formy render token"),
+		ipHashes:         NewSigner(cfg.JWTSecret, "formy ip hash"),
+		verifyTokens:     NewSigner(cfg.JWTSecret, "formy email verification"),
+		tokenVersions:    newTokenVersionCache(tokenVersionTTL),
+		refreshRotations: newRefreshRotations(),
+		rateLimits:       cfg.RateLimits,
+		rateLimiter:      NewRateLimiter(cfg.RateLimits.IdleTimeout),
+		mailer:           NewMailer(cfg.Mail, e),
+		mailSender:       cfg.Mail.Sender,
+		webhookClient:    newWebhookClient(),
+		models:           m,
+		e:                e,
+		TemplateManager:  tm,
+		Jobs:             NewJobQueue(m.Jobs, cfg.JobWorkers, e),
+	}
+
+	s.Jobs.Handle(JobNotifySubmission, s.handleNotifySubmission)
+	s.Jobs.Handle(JobDispatchWebhooks, s.handleDispatchWebhooks)
+	s.Jobs.Handle(JobDeliverWebhook, s.handleDeliverWebhook)
+	s.Jobs.Handle(JobSendVerification, s.handleSendVerification)
+	s.Jobs.Handle(JobSendPasswordReset, s.handleSendPasswordReset)
+
+	return s, nil
 }
 
 func (s *Services) Close() {
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshSession(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	s := &Services{
+		models:           m,
+		e:                e,
+		jwtSecret:        "secret",
+		tokenVersions:    newTokenVersionCache(time.Minute),
+		refreshRotations: newRefreshRotations(),
+	}
+
+	userID, err := models.InsertTestUser(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	login := func() Session {
+		form := url.Values{"user_name": {models.ValidUserName}, "password": {models.ValidUserPassword}}
+		req := httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+
+		session, err := s.UserLogin(e.NewContext(req, httptest.NewRecorder()))
+		assert.NoError(t, err)
+		return session
+	}
+
+	session := login()
+	token, err := s.ParseAccessToken(session.Access.Token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, userID, token.Claims.(*JWTCustomClaims).UserID)
+	}
+	assert.WithinDuration(t, time.Now().Add(AccessTokenTTL), session.Access.ExpiresAt, time.Minute)
+
+	rotated, err := s.RefreshSession(session.Refresh.Token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, session.Refresh.Token, rotated.Refresh.Token)
+	assert.Equal(t, models.ValidUserName, rotated.Refresh.Username)
+
+	// Requests sent together present the same token, and all get the same
+	// successor.
+	var wg sync.WaitGroup
+	concurrent := make([]Session, 4)
+	errs := make([]error, len(concurrent))
+	for i := range concurrent {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			concurrent[i], errs[i] = s.RefreshSession(rotated.Refresh.Token)
+		}()
+	}
+	wg.Wait()
+	for i := range concurrent {
+		if assert.NoError(t, errs[i]) {
+			assert.Equal(t, concurrent[0].Refresh.Token, concurrent[i].Refresh.Token)
+		}
+	}
+	session, rotated = rotated, concurrent[0]
+
+	// After the grace period, presenting a rotated token again ends the
+	// whole session, including the token issued in its place.
+	_, err = db.Exec(`UPDATE refresh_tokens SET rotated_at = datetime('now', '-1 minute') WHERE rotated_at IS NOT NULL`)
+	assert.NoError(t, err)
+	_, err = s.RefreshSession(session.Refresh.Token)
+	assert.ErrorIs(t, err, models.ErrTokenReuse)
+	_, err = s.RefreshSession(rotated.Refresh.Token)
+	assert.ErrorIs(t, err, models.ErrTokenReuse)
+
+	_, err = s.RefreshSession("unknown")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Logging out of one session leaves the others alone.
+	first, second := login(), login()
+	assert.NoError(t, s.Logout(first.Refresh.Token))
+
+	_, err = s.RefreshSession(first.Refresh.Token)
+	assert.ErrorIs(t, err, models.ErrTokenReuse)
+	second, err = s.RefreshSession(second.Refresh.Token)
+	assert.NoError(t, err)
+	_, err = s.AuthenticateAccessToken(second.Access.Token)
+	assert.NoError(t, err)
+
+	// Signing out everywhere ends the remaining sessions right away, before
+	// their access tokens expire.
+	assert.NoError(t, s.SignOutEverywhere(userID))
+	_, err = s.AuthenticateAccessToken(second.Access.Token)
+	assert.ErrorIs(t, err, ErrRevokedAccessToken)
+	_, err = s.RefreshSession(second.Refresh.Token)
+	assert.ErrorIs(t, err, models.ErrTokenReuse)
+
+	third := login()
+	_, err = s.AuthenticateAccessToken(third.Access.Token)
+	assert.NoError(t, err)
+
+	// So does changing the password, once the cached version expires.
+	assert.NoError(t, m.Users.UpdatePassword(userID, models.ValidUserPassword, "tortuga-azul-42"))
+	s.tokenVersions.forget(userID)
+	_, err = s.AuthenticateAccessToken(third.Access.Token)
+	assert.ErrorIs(t, err, ErrRevokedAccessToken)
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner("secret", "render token")
+	token := signer.Sign("1.1700000000.nonce")
+
+	tests := []struct {
+		TestName    string
+		signer      *Signer
+		token       string
+		expectError bool
+	}{
+		{TestName: "Valid token", signer: signer, token: token},
+		{TestName: "Other purpose", signer: NewSigner("secret", "email verification"), token: token, expectError: true},
+		{TestName: "Other secret", signer: NewSigner("other", "render token"), token: token, expectError: true},
+		{TestName: "Tampered payload", signer: signer, token: "x" + token, expectError: true},
+		{TestName: "Missing signature", signer: signer, token: "MS4xNzAwMDAwMDAwLm5vbmNl", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			payload, err := tt.signer.Verify(tt.token)
+			if tt.expectError {
+				assert.ErrorIs(t, err, ErrInvalidSignature)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "1.1700000000.nonce", payload)
+		})
+	}
+}
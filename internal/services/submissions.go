@@ -4,13 +4,30 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"reflect"
+	"slices"
 
+	"formy.fprzg.net/internal/models"
 	"formy.fprzg.net/internal/types"
 )
 
+// MaxSubmissionMemory caps the size of JSON bodies and the part of multipart
+// bodies kept in memory while parsing a submission.
+const MaxSubmissionMemory = 32 << 20
+
+// MaxSubmissionSize caps whole submission bodies, uploads included, since
+// what doesn't fit in memory is spooled to temporary files.
+const MaxSubmissionSize = 64 << 20
+
+// Limits on the unexpected fields kept from a single submission.
+const (
+	maxUnexpectedFields        = 20
+	maxUnexpectedNameLength    = 64
+	maxUnexpectedContentLength = 1024
+)
+
 type SubmissionsServiceInterface interface {
 	ProcessSubmission(formID int, r *http.Request, ctx context.Context) (int, error)
 	GetSubmissionFromRequest(form types.FormData, r *http.Request, ctx context.Context) (types.SubmissionData, error)
@@ -27,7 +44,41 @@ func (s *Services) ProcessSubmission(formID int, r *http.Request, ctx context.Co
 		return 0, err
 	}
 
-	return s.models.Submissions.Insert(submission, ctx)
+	var jobKinds []string
+	if submission.Status == types.SubmissionStatusAccepted {
+		if formData.Settings.Notify {
+			jobKinds = append(jobKinds, JobNotifySubmission)
+		}
+
+		webhooks, err := s.models.Webhooks.GetByFormID(formID)
+		if err != nil {
+			return 0, err
+		}
+		if len(webhooks) > 0 {
+			jobKinds = append(jobKinds, JobDispatchWebhooks)
+		}
+	}
+
+	submissionID, err := s.models.Submissions.Insert(submission, ctx, jobKinds...)
+	if errors.Is(err, models.ErrFormTokenUsed) {
+		const problem = "form token already used"
+		if formData.Settings.TokenPolicy == types.TokenPolicyReject {
+			return 0, renderTokenError(problem)
+		}
+
+		s.e.Logger.Printf("Insert: %s for form %d; storing as spam.\n", problem, formID)
+		jobKinds = nil
+		submissionID, err = s.models.Submissions.Insert(replayedSubmission(submission), ctx)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if len(jobKinds) > 0 {
+		s.Jobs.Wake()
+	}
+
+	return submissionID, nil
 }
 
 func (s *Services) GetSubmissionFromRequest(form types.FormData, r *http.Request, ctx context.Context) (types.SubmissionData, error) {
@@ -36,35 +87,202 @@ func (s *Services) GetSubmissionFromRequest(form types.FormData, r *http.Request
 		return types.SubmissionData{}, err
 	}
 
-	if err = r.ParseForm(); err != nil {
+	s.patterns.apply(formInstanceID, form.Fields)
+
+	r.Body = http.MaxBytesReader(nil, r.Body, MaxSubmissionSize)
+	values, err := types.SubmissionValuesFromRequest(r, MaxSubmissionMemory)
+	if err != nil {
+		return types.SubmissionData{}, err
+	}
+
+	metadata, err := json.Marshal(s.RequestMetadata(form, r))
+	if err != nil {
 		return types.SubmissionData{}, err
 	}
 
 	submission := types.SubmissionData{
 		FormID:         form.ID,
 		FormInstanceID: formInstanceID,
-		Metadata:       `{ "user_agent": "curl uwu", "ip_address": "0.0.0.0" } `,
+		Status:         types.SubmissionStatusAccepted,
+		Metadata:       string(metadata),
+	}
+
+	storeAsSpam := func(reason string) (types.SubmissionData, error) {
+		s.e.Logger.Printf("Insert: %s for form %d; storing as spam.\n", reason, form.ID)
+		submission.Status = types.SubmissionStatusSpam
+		submission.Fields, err = spamFields(form, values)
+		if err != nil {
+			return types.SubmissionData{}, err
+		}
+		return submission, nil
+	}
+
+	var token *types.FormToken
+	policy := form.Settings.TokenPolicy
+	if filledHoneypot(form.Settings.Honeypots, values) {
+		return storeAsSpam("honeypot filled")
+	}
+	if policy != "" {
+		sent, _ := values.First(types.RenderTokenField).(string)
+		checked, problem := s.checkRenderToken(form, sent)
+		if problem != "" {
+			if policy == types.TokenPolicyReject {
+				return types.SubmissionData{}, renderTokenError(problem)
+			}
+			return storeAsSpam(problem)
+		}
+		token = &checked
+	}
+
+	receivedNames := make([]string, 0, len(values))
+	for fieldName := range values {
+		receivedNames = append(receivedNames, fieldName)
 	}
+	if r.MultipartForm != nil {
+		for fieldName := range r.MultipartForm.File {
+			receivedNames = append(receivedNames, fieldName)
+		}
+	}
+
+	var unexpected []string
+	for _, fieldName := range receivedNames {
+		if fieldName == types.RenderTokenField || slices.Contains(form.Settings.Honeypots, fieldName) {
+			continue
+		}
+		if form.GetFieldIndex(fieldName) == -1 {
+			unexpected = append(unexpected, fieldName)
+		}
+	}
+	slices.Sort(unexpected)
+	unexpected = slices.Compact(unexpected)
+	if len(unexpected) > maxUnexpectedFields {
+		s.e.Logger.Printf("Insert: %d unexpected fields; keeping the first %d.\n", len(unexpected), maxUnexpectedFields)
+		unexpected = unexpected[:maxUnexpectedFields]
+	}
+
+	if len(unexpected) > 0 {
+		switch form.Settings.UnexpectedFields {
+		case types.UnexpectedFieldsIgnore:
+			s.e.Logger.Printf("Insert: unexpected fields %v; skipping.\n", unexpected)
+
+		case types.UnexpectedFieldsReject:
+			incident := types.Incident{
+				FormID: form.ID,
+				Kind:   types.IncidentUnexpectedFields,
+				Policy: types.UnexpectedFieldsReject,
+			}
+			var fieldErrors types.ValidationErrors
+			for _, fieldName := range unexpected {
+				fieldName = truncateString(fieldName, maxUnexpectedNameLength)
+				if slices.Contains(incident.Fields, fieldName) {
+					continue
+				}
+				incident.Fields = append(incident.Fields, fieldName)
+				fieldErrors = append(fieldErrors, types.FieldError{
+					Field:      fieldName,
+					Constraint: types.ConstraintUnexpected,
+					Message:    fmt.Sprintf("unexpected field '%s'", fieldName),
+				})
+			}
+
+			if _, err := s.models.Incidents.Insert(incident); err != nil {
+				return types.SubmissionData{}, err
+			}
+			return types.SubmissionData{}, fieldErrors
+
+		default:
+			submission.UnexpectedFields, err = unexpectedFields(r, values, unexpected)
+			if err != nil {
+				return types.SubmissionData{}, err
+			}
+		}
+	}
+
+	states := types.EvaluateFieldRules(form.Fields, values, s.timeLayouts)
+
+	var fieldErrors types.ValidationErrors
+	var uploads []pendingUpload
+	for _, formField := range form.Fields {
+		fieldContents := values[formField.Name]
+		content := values.First(formField.Name)
+
+		state := states[formField.Name]
+		if !state.Visible {
+			if hasValue(fieldContents) || len(uploadedFiles(r, formField.Name)) > 0 {
+				fieldErrors = append(fieldErrors, types.FieldError{
+					Field:      formField.Name,
+					Constraint: types.ConstraintRule,
+					Message:    "field is not part of the form for the given answers",
+				})
+			}
+			continue
+		}
+		if state.Required {
+			formField = requireField(formField)
+		}
+
+		if formField.Type == types.FieldTypeFile {
+			if !types.IsEmptyValue(content) {
+				fieldErrors = append(fieldErrors, types.FieldError{
+					Field:      formField.Name,
+					Constraint: types.ConstraintType,
+					Message:    "files must be uploaded using multipart/form-data",
+				})
+				continue
+			}
+
+			infos, fieldUploads, err := inspectUploads(formField.Name, uploadedFiles(r, formField.Name))
+			if err != nil {
+				return types.SubmissionData{}, err
+			}
+
+			if errs := types.CheckFileConstraints(formField, infos); len(errs) > 0 {
+				fieldErrors = append(fieldErrors, errs...)
+				continue
+			}
+
+			uploads = append(uploads, fieldUploads...)
+			continue
+		}
 
-	for fieldName, fieldContents := range r.Form {
-		fieldIndex := form.GetFieldIndex(fieldName)
-		if fieldIndex == -1 {
-			// TODO: Report incident
-			s.e.Logger.Printf("Insert: unknown field %s; skipping.\n", fieldName)
+		_, isList := types.ListElemType(formField.Type)
+		if isList {
+			var items []interface{}
+			for _, v := range fieldContents {
+				if !types.IsEmptyValue(v) {
+					items = append(items, v)
+				}
+			}
+			content = nil
+			if len(items) > 0 {
+				content = items
+			}
+		}
+
+		if types.IsEmptyValue(content) {
+			fieldErrors = append(fieldErrors, types.CheckFieldConstraints(formField, nil)...)
 			continue
 		}
 
-		formField := form.Fields[fieldIndex]
+		coerced, err := types.CoerceValue(content, formField.Type, s.timeLayouts)
+		if err != nil {
+			fieldErrors = append(fieldErrors, types.FieldError{
+				Field:      formField.Name,
+				Constraint: types.ConstraintType,
+				Message:    err.Error(),
+			})
+			continue
+		}
 
 		subField := types.SubmissionField{
 			Name:    formField.Name,
 			Type:    formField.Type,
-			Content: fieldContents[0],
+			Content: coerced,
 		}
 
-		if !types.TypesMatch(subField.Content, subField.Type) {
-			receivedType := reflect.ValueOf(subField.Content).Kind()
-			return types.SubmissionData{}, fmt.Errorf("invalid field type at '%s': expected '%s' but received '%v'", subField.Name, subField.Type, receivedType)
+		if errs := types.CheckFieldConstraints(formField, subField.Content); len(errs) > 0 {
+			fieldErrors = append(fieldErrors, errs...)
+			continue
 		}
 
 		if subField.Type == "string" {
@@ -79,18 +297,23 @@ func (s *Services) GetSubmissionFromRequest(form types.FormData, r *http.Request
 		}
 
 		for _, constraint := range formField.Constraints {
-			if constraint.Name == "unique" {
+			if constraint.Name == types.ConstraintUnique {
 				h := sha256.New()
 				h.Write([]byte(subField.ContentAsString))
 				fieldHash := string(h.Sum(nil))
 
-				exists, err := s.models.Submissions.CheckForRepeatedUniqueField(formInstanceID, fieldName, fieldHash)
+				exists, err := s.models.Submissions.CheckForRepeatedUniqueField(formInstanceID, subField.Name, fieldHash)
 				if err != nil {
 					return types.SubmissionData{}, err
 				}
 				if exists {
-					s.e.Logger.Printf("Insert: duplicate unique field detected: '%s'.\n", fieldName)
-					return types.SubmissionData{}, fmt.Errorf("models: duplicate unique field %v", fieldName)
+					s.e.Logger.Printf("Insert: duplicate unique field detected: '%s'.\n", subField.Name)
+					fieldErrors = append(fieldErrors, types.FieldError{
+						Field:      subField.Name,
+						Constraint: constraint.Name,
+						Message:    "value has already been submitted",
+					})
+					break
 				}
 
 				subField.Unique = true
@@ -100,10 +323,163 @@ func (s *Services) GetSubmissionFromRequest(form types.FormData, r *http.Request
 
 		submission.Fields = append(submission.Fields, subField)
 
-		if len(fieldContents) > 1 {
-			s.e.Logger.Printf("Insert: multiple values for field %s; only first saved.\n", fieldName)
+		if !isList && len(fieldContents) > 1 {
+			s.e.Logger.Printf("Insert: multiple values for field %s; only first saved.\n", subField.Name)
 		}
 	}
 
+	if len(fieldErrors) > 0 {
+		return types.SubmissionData{}, fieldErrors
+	}
+
+	submission.Files, err = s.storeUploads(uploads)
+	if err != nil {
+		return types.SubmissionData{}, err
+	}
+
+	// The token is only used up along with an accepted submission, so fixing
+	// validation errors doesn't need a new one.
+	submission.Token = token
+
 	return submission, nil
 }
+
+// unexpectedFields returns the values sent for the given fields, which the
+// form doesn't have. Only the names of uploaded files are kept.
+func unexpectedFields(r *http.Request, values types.SubmissionValues, names []string) ([]types.UnexpectedField, error) {
+	type group struct {
+		name     string
+		contents []string
+		files    int
+	}
+
+	// Names left equal by truncating them would collide when stored, so
+	// their contents are kept together under that name.
+	var groups []group
+	index := make(map[string]int)
+	for _, name := range names {
+		short := truncateString(name, maxUnexpectedNameLength)
+		i, ok := index[short]
+		if !ok {
+			i = len(groups)
+			index[short] = i
+			groups = append(groups, group{name: short})
+		}
+		g := &groups[i]
+
+		for _, v := range values[name] {
+			g.contents = append(g.contents, fmt.Sprint(v))
+		}
+		files := uploadedFiles(r, name)
+		for _, fh := range files {
+			g.contents = append(g.contents, fh.Filename)
+		}
+		g.files += len(files)
+	}
+
+	fields := make([]types.UnexpectedField, 0, len(groups))
+	for _, g := range groups {
+		field := types.UnexpectedField{Name: g.name}
+		if len(g.contents) == 1 && g.files == 0 {
+			field.Content = g.contents[0]
+		} else {
+			buf, err := json.Marshal(g.contents)
+			if err != nil {
+				return nil, err
+			}
+			field.Content = string(buf)
+		}
+		field.Content = truncateString(field.Content, maxUnexpectedContentLength)
+
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// replayedSubmission turns an accepted submission whose token turned out to
+// be used into spam. Like other spam it doesn't claim unique values, but its
+// files are already stored, so they're kept.
+func replayedSubmission(submission types.SubmissionData) types.SubmissionData {
+	submission.Status = types.SubmissionStatusSpam
+	submission.Token = nil
+
+	fields := make([]types.SubmissionField, len(submission.Fields))
+	for i, field := range submission.Fields {
+		field.Unique = false
+		fields[i] = field
+	}
+	submission.Fields = fields
+
+	return submission
+}
+
+// filledHoneypot reports whether any of the honeypot inputs got a value.
+func filledHoneypot(honeypots []string, values types.SubmissionValues) bool {
+	for _, name := range honeypots {
+		if hasValue(values[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+// spamFields keeps the values sent for the form's fields as they came, so
+// owners can review false positives. Spam skips validation so bots get the
+// same answer as everyone else, and it doesn't claim unique values or store
+// uploads.
+func spamFields(form types.FormData, values types.SubmissionValues) ([]types.SubmissionField, error) {
+	var fields []types.SubmissionField
+	for _, formField := range form.Fields {
+		if formField.Type == types.FieldTypeFile || !hasValue(values[formField.Name]) {
+			continue
+		}
+
+		subField := types.SubmissionField{
+			Name:    formField.Name,
+			Type:    formField.Type,
+			Content: values.First(formField.Name),
+		}
+		if _, isList := types.ListElemType(formField.Type); isList {
+			subField.Content = values[formField.Name]
+		}
+
+		if str, ok := subField.Content.(string); ok {
+			subField.ContentAsString = str
+		} else {
+			buf, err := json.Marshal(subField.Content)
+			if err != nil {
+				return nil, fmt.Errorf("insert: failed to marshal field data: %v", err)
+			}
+			subField.ContentAsString = string(buf)
+		}
+
+		fields = append(fields, subField)
+	}
+	return fields, nil
+}
+
+// hasValue reports whether any of the submitted values isn't empty. Browsers
+// send empty inputs for fields the client has hidden, so they are ignored.
+func hasValue(values []interface{}) bool {
+	for _, v := range values {
+		if !types.IsEmptyValue(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireField returns a copy of field with the required constraint, used
+// when a rule makes an otherwise optional field mandatory.
+func requireField(field types.FormField) types.FormField {
+	for _, c := range field.Constraints {
+		if c.Name == types.ConstraintRequired {
+			return field
+		}
+	}
+
+	constraints := make([]types.FieldConstraint, 0, len(field.Constraints)+1)
+	constraints = append(constraints, types.FieldConstraint{Name: types.ConstraintRequired})
+	field.Constraints = append(constraints, field.Constraints...)
+	return field
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"formy.fprzg.net/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnexpectedFields(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("note", "hello")
+	w.WriteField("tags", "a")
+	w.WriteField("tags", "b")
+	w.WriteField("long", strings.Repeat("x", maxUnexpectedContentLength+10))
+	fw, _ := w.CreateFormFile("attachment", "cv.pdf")
+	fw.Write([]byte("%PDF-1.4"))
+	w.Close()
+
+	r := httptest.NewRequest("POST", "/api/submissions/new/1", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	values, err := types.SubmissionValuesFromRequest(r, MaxSubmissionMemory)
+	assert.NoError(t, err)
+
+	fields, err := unexpectedFields(r, values, []string{"attachment", "long", "note", "tags"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []types.UnexpectedField{
+		{Name: "attachment", Content: `["cv.pdf"]`},
+		{Name: "long", Content: strings.Repeat("x", maxUnexpectedContentLength)},
+		{Name: "note", Content: "hello"},
+		{Name: "tags", Content: `["a","b"]`},
+	}, fields)
+}
+
+func TestUnexpectedFieldsSharingTruncatedName(t *testing.T) {
+	prefix := strings.Repeat("n", maxUnexpectedNameLength)
+	values := types.SubmissionValues{
+		prefix + "a": {"first"},
+		prefix + "b": {"second"},
+	}
+	r := httptest.NewRequest("POST", "/api/submissions/new/1", nil)
+
+	fields, err := unexpectedFields(r, values, []string{prefix + "a", prefix + "b"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []types.UnexpectedField{
+		{Name: prefix, Content: `["first","second"]`},
+	}, fields)
+}
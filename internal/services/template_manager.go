@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	texttemplate "text/template"
 	"time"
 
 	"formy.fprzg.net/internal/models"
@@ -22,6 +23,7 @@ import (
 type TemplateManager struct {
 	sync.RWMutex
 	templates map[string]*template.Template
+	emails    map[string]emailTemplate
 	watcher   *fsnotify.Watcher
 	e         *echo.Echo
 }
@@ -36,14 +38,31 @@ type TemplateData struct {
 	FormsData       map[string]any
 	SubmissionsData map[string]any
 	UserData        models.User
+	PublicForm      *FormView
+	SuccessMessage  string
+	// FieldErrors and FieldValues refill a form sent back because of
+	// validation errors, keyed by input name.
+	FieldErrors map[string]string
+	FieldValues map[string]string
 }
 
 const (
 	UserInterfaceDir = "../../ui"
 	BaseTemplatePath = "../../ui/base.tmpl.html"
 	PagesDir         = "../../ui/pages"
+
+	EmailsDir             = "../../ui/emails"
+	EmailBaseTemplatePath = "../../ui/emails/base.tmpl.html"
 )
 
+// emailTemplate renders an email from a file in EmailsDir that defines the
+// "subject", "text" and "html" templates. The text version isn't HTML
+// escaped, so it's parsed apart.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *template.Template
+}
+
 func NewTemplateData(r *http.Request) *TemplateData {
 	td := &TemplateData{
 		Year:  time.Now().Year(),
@@ -118,8 +137,45 @@ func (tm *TemplateManager) compileTemplates() error {
 		return err
 	}
 
+	emails := make(map[string]emailTemplate)
+
+	err = filepath.Walk(EmailsDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || path == EmailBaseTemplatePath || !strings.HasSuffix(path, ".tmpl.html") {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(EmailsDir, path)
+		if err != nil {
+			return err
+		}
+
+		text, err := texttemplate.New("text").ParseFiles(path)
+		if err != nil {
+			tm.e.Logger.Printf("Error parsing email template %s: %v\n", path, err)
+			return nil
+		}
+
+		html, err := template.New("base").ParseFiles(EmailBaseTemplatePath, path)
+		if err != nil {
+			tm.e.Logger.Printf("Error parsing email template %s: %v\n", path, err)
+			return nil
+		}
+
+		emails[filepath.ToSlash(relPath)] = emailTemplate{text: text, html: html}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
 	tm.templates = templates
-	tm.e.Logger.Printf("[template_manager] Templates compiled: %d\n", len(templates))
+	tm.emails = emails
+	tm.e.Logger.Printf("[template_manager] Templates compiled: %d, emails: %d\n", len(templates), len(emails))
 
 	return nil
 }
@@ -185,6 +241,36 @@ func (tm *TemplateManager) ExecuteTemplate(name string, data interface{}) (strin
 	return buf.String(), nil
 }
 
+// ExecuteEmail renders the email template name. The returned message has no
+// sender or recipients yet.
+func (tm *TemplateManager) ExecuteEmail(name string, data interface{}) (Message, error) {
+	tm.RLock()
+	defer tm.RUnlock()
+
+	tmpl, ok := tm.emails[name]
+	if !ok {
+		return Message{}, fmt.Errorf("email template %s not found", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "base", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		// Subjects are a single header line.
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
 func (tm *TemplateManager) Close() error {
 	if tm.watcher != nil {
 		return tm.watcher.Close()
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenVersionTTL is how long a token version is cached. Sessions revoked by
+// another process stop working after at most this long; the process that
+// revokes them forgets the version right away.
+const tokenVersionTTL = 30 * time.Second
+
+// maxCachedTokenVersions bounds the cache; like the pattern cache, it's
+// simply emptied once it grows past this size.
+const maxCachedTokenVersions = 4096
+
+// tokenVersionCache keeps the token version of recently seen users, so
+// checking an access token doesn't hit the database on every request.
+type tokenVersionCache struct {
+	mu       sync.Mutex
+	versions map[int]cachedTokenVersion
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+type cachedTokenVersion struct {
+	version   int
+	fetchedAt time.Time
+}
+
+func newTokenVersionCache(ttl time.Duration) *tokenVersionCache {
+	return &tokenVersionCache{
+		versions: make(map[int]cachedTokenVersion),
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// get returns the token version of userID, calling load when it isn't cached
+// or the cached one is too old.
+func (tc *tokenVersionCache) get(userID int, load func(int) (int, error)) (int, error) {
+	tc.mu.Lock()
+	cached, ok := tc.versions[userID]
+	tc.mu.Unlock()
+
+	now := tc.now()
+	if ok && now.Sub(cached.fetchedAt) < tc.ttl {
+		return cached.version, nil
+	}
+
+	version, err := load(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	tc.mu.Lock()
+	if len(tc.versions) >= maxCachedTokenVersions {
+		tc.versions = make(map[int]cachedTokenVersion)
+	}
+	tc.versions[userID] = cachedTokenVersion{version: version, fetchedAt: now}
+	tc.mu.Unlock()
+
+	return version, nil
+}
+
+// forget drops the cached version of userID, after it was bumped.
+func (tc *tokenVersionCache) forget(userID int) {
+	tc.mu.Lock()
+	delete(tc.versions, userID)
+	tc.mu.Unlock()
+}
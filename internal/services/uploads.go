@@ -0,0 +1,118 @@
+package services
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+
+	"formy.fprzg.net/internal/types"
+)
+
+type pendingUpload struct {
+	fieldName string
+	mimeType  string
+	header    *multipart.FileHeader
+}
+
+// uploadedFiles returns the files sent for fieldName in a multipart request.
+func uploadedFiles(r *http.Request, fieldName string) []*multipart.FileHeader {
+	if r.MultipartForm == nil {
+		return nil
+	}
+	return r.MultipartForm.File[fieldName]
+}
+
+// inspectUploads detects the real content type of every file instead of
+// trusting the one declared by the client.
+func inspectUploads(fieldName string, headers []*multipart.FileHeader) ([]types.FileInfo, []pendingUpload, error) {
+	infos := make([]types.FileInfo, 0, len(headers))
+	uploads := make([]pendingUpload, 0, len(headers))
+
+	for _, fh := range headers {
+		mimeType, err := sniffMimeType(fh)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		infos = append(infos, types.FileInfo{
+			Name:     fh.Filename,
+			Size:     fh.Size,
+			MimeType: mimeType,
+		})
+		uploads = append(uploads, pendingUpload{
+			fieldName: fieldName,
+			mimeType:  mimeType,
+			header:    fh,
+		})
+	}
+
+	return infos, uploads, nil
+}
+
+func sniffMimeType(fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "application/octet-stream", nil
+	}
+
+	return mimeType, nil
+}
+
+// storeUploads copies the uploads into the blob store. It only runs once the
+// whole submission is valid, so rejected submissions don't leave blobs behind.
+func (s *Services) storeUploads(uploads []pendingUpload) ([]types.SubmissionFile, error) {
+	var files []types.SubmissionFile
+
+	for _, u := range uploads {
+		f, err := u.header.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		hash, size, err := s.blobs.Put(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, types.SubmissionFile{
+			FieldName: u.fieldName,
+			FileName:  u.header.Filename,
+			MimeType:  u.mimeType,
+			Size:      size,
+			Hash:      hash,
+		})
+	}
+
+	return files, nil
+}
+
+// OpenSubmissionFile returns an uploaded file as long as userID owns the form
+// it was submitted to. The caller must close the returned file.
+func (s *Services) OpenSubmissionFile(userID, fileID int) (types.SubmissionFile, *os.File, error) {
+	file, err := s.models.Submissions.GetFile(userID, fileID)
+	if err != nil {
+		return types.SubmissionFile{}, nil, err
+	}
+
+	f, err := s.blobs.Open(file.Hash)
+	if err != nil {
+		return types.SubmissionFile{}, nil, err
+	}
+
+	return file, f, nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmissionUploads(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	blobDir := filepath.Join(t.TempDir(), "blobs")
+	blobs, err := NewBlobStore(blobDir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	s := &Services{
+		models:      m,
+		e:           e,
+		blobs:       blobs,
+		timeLayouts: types.DefaultTimeLayouts,
+		patterns:    newPatternCache(),
+		ipHashes:    NewSigner("secret", "formy ip hash"),
+	}
+
+	userID, err := models.InsertTestUser(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	otherID, err := m.Users.Insert("bruno", "bruno@example.com", "tortuga-azul-42")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	form, err := s.CreateForm(userID, types.FormData{
+		Name: "Empleo",
+		Fields: []types.FormField{
+			{Name: "name", Type: "string", Constraints: []types.FieldConstraint{{Name: "required"}}},
+			{Name: "cv", Type: types.FieldTypeFile, Constraints: []types.FieldConstraint{{Name: types.ConstraintMaxSize, Max: 1024}}},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	submit := func(name string, cv []byte) (int, error) {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		w.WriteField("name", name)
+		fw, _ := w.CreateFormFile("cv", "cv.pdf")
+		fw.Write(cv)
+		w.Close()
+
+		r := httptest.NewRequest(http.MethodPost, "/api/submissions/new/1", &body)
+		r.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+		return s.ProcessSubmission(form.ID, r, context.Background())
+	}
+	storedBlobs := func() int {
+		var n int
+		filepath.WalkDir(blobDir, func(path string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+
+	cv := []byte("%PDF-1.4 curriculum")
+
+	// Rejected submissions don't store their files.
+	_, err = submit("", cv)
+	assert.ErrorAs(t, err, &types.ValidationErrors{})
+	_, err = submit("Ana", bytes.Repeat([]byte("x"), 2048))
+	assert.ErrorAs(t, err, &types.ValidationErrors{})
+	assert.Equal(t, 0, storedBlobs())
+
+	submissionID, err := submit("Ana", cv)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = submit("Bea", cv)
+	assert.NoError(t, err)
+
+	// Both submissions share the blob of the same file.
+	assert.Equal(t, 1, storedBlobs())
+
+	data, err := m.Submissions.GetData(submissionID)
+	if !assert.NoError(t, err) || !assert.Len(t, data.Files, 1) {
+		return
+	}
+	file := data.Files[0]
+	assert.Equal(t, "cv.pdf", file.FileName)
+	assert.Equal(t, "application/pdf", file.MimeType)
+	assert.Equal(t, int64(len(cv)), file.Size)
+
+	// Only the owner of the form gets the file.
+	_, _, err = s.OpenSubmissionFile(otherID, file.ID)
+	assert.ErrorIs(t, err, models.ErrNoRecord)
+
+	_, f, err := s.OpenSubmissionFile(userID, file.ID)
+	if assert.NoError(t, err) {
+		content, err := io.ReadAll(f)
+		f.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, cv, content)
+	}
+}
@@ -1,8 +1,16 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
 	"time"
 
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
@@ -14,23 +22,204 @@ type JWTCustomClaims struct {
 	UserName string `json:"user_name"`
 	UserID   int    `json:"user_id"`
 	//Admin bool   `json:"admin"`
+	// TokenVersion is users.token_version when the token was issued.
+	TokenVersion int `json:"token_version"`
 	jwt.RegisteredClaims
 }
 
-func (s *Services) UserLogin(c echo.Context) (string, error) {
+const (
+	// AccessTokenTTL is how long a JWT works. Browsers get a new one with
+	// their refresh token once it expires.
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a session lasts without being used.
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("services: invalid refresh token")
+	ErrRevokedAccessToken  = errors.New("services: revoked access token")
+)
+
+// Session holds the tokens handed out at login and on every refresh.
+type Session struct {
+	Access  types.Token
+	Refresh types.Token
+}
+
+// randomToken returns a random URL safe token.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how tokens sent to users are stored, so a leaked table can't
+// be used to log in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Services) UserLogin(c echo.Context) (Session, error) {
 	userName := c.FormValue("user_name")
 	password := c.FormValue("password")
 
 	userID, err := s.models.Users.Authenticate(userName, password)
 	if err != nil {
-		return "", echo.ErrUnauthorized
+		if errors.Is(err, models.ErrInactiveAccount) {
+			return Session{}, err
+		}
+		return Session{}, echo.ErrUnauthorized
+	}
+
+	family, err := randomToken()
+	if err != nil {
+		return Session{}, err
+	}
+
+	refresh, err := s.newRefreshToken(userName)
+	if err != nil {
+		return Session{}, err
+	}
+
+	err = s.models.RefreshTokens.Insert(userID, hashToken(refresh.Token), family, refresh.ExpiresAt)
+	if err != nil {
+		return Session{}, err
+	}
+
+	access, err := s.newAccessToken(userID, userName)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{Access: access, Refresh: refresh}, nil
+}
+
+// RefreshSession trades a refresh token for a new access token and the next
+// refresh token of its family. A token presented again within
+// RefreshGracePeriod gets the same successor; after that it returns
+// models.ErrTokenReuse, and the session it belongs to is over.
+func (s *Services) RefreshSession(refreshToken string) (Session, error) {
+	if refreshToken == "" {
+		return Session{}, ErrInvalidRefreshToken
+	}
+
+	userID, refresh, err := s.rotateRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			return Session{}, ErrInvalidRefreshToken
+		case errors.Is(err, models.ErrTokenReuse):
+			s.e.Logger.Printf("[auth] Refresh token reused, revoked its session.\n")
+		}
+		return Session{}, err
+	}
+
+	user, err := s.models.Users.Get(userID)
+	if err != nil {
+		return Session{}, err
+	}
+	refresh.Username = user.UserName
+
+	access, err := s.newAccessToken(userID, user.UserName)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{Access: access, Refresh: refresh}, nil
+}
+
+// rotateRefreshToken rotates the refresh token with the given hash, or
+// returns its successor if it was rotated moments ago.
+func (s *Services) rotateRefreshToken(tokenHash string) (int, types.Token, error) {
+	s.refreshRotations.mu.Lock()
+	defer s.refreshRotations.mu.Unlock()
+
+	refresh, err := s.newRefreshToken("")
+	if err != nil {
+		return 0, types.Token{}, err
 	}
 
+	userID, err := s.models.RefreshTokens.Rotate(tokenHash, hashToken(refresh.Token), refresh.ExpiresAt, RefreshGracePeriod)
+	if errors.Is(err, models.ErrTokenRotated) {
+		// Only the process that rotated the token knows its successor. Elsewhere
+		// the request fails, but the session goes on.
+		successor, ok := s.refreshRotations.successor(tokenHash)
+		if !ok {
+			return 0, types.Token{}, ErrInvalidRefreshToken
+		}
+		return userID, successor, nil
+	}
+	if err != nil {
+		return 0, types.Token{}, err
+	}
+
+	s.refreshRotations.add(tokenHash, refresh)
+	return userID, refresh, nil
+}
+
+// Logout revokes the session of a refresh token.
+func (s *Services) Logout(refreshToken string) error {
+	if refreshToken == "" {
+		return nil
+	}
+	return s.models.RefreshTokens.RevokeFamily(hashToken(refreshToken))
+}
+
+// SignOutEverywhere ends every session of a user, on every device.
+func (s *Services) SignOutEverywhere(userID int) error {
+	defer s.tokenVersions.forget(userID)
+	return s.models.Users.RevokeSessions(userID)
+}
+
+// AuthenticateAccessToken validates a JWT like ParseAccessToken, and also
+// checks that its user hasn't revoked it since it was issued.
+func (s *Services) AuthenticateAccessToken(token string) (*jwt.Token, error) {
+	t, err := s.ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := t.Claims.(*JWTCustomClaims)
+	version, err := s.tokenVersions.get(claims.UserID, s.models.Users.GetTokenVersion)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, ErrRevokedAccessToken
+		}
+		return nil, err
+	}
+	if claims.TokenVersion != version {
+		return nil, ErrRevokedAccessToken
+	}
+
+	return t, nil
+}
+
+// ParseAccessToken validates a JWT issued by newAccessToken.
+func (s *Services) ParseAccessToken(token string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(token, new(JWTCustomClaims), func(t *jwt.Token) (interface{}, error) {
+		return []byte(s.jwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+}
+
+func (s *Services) newAccessToken(userID int, userName string) (types.Token, error) {
+	version, err := s.tokenVersions.get(userID, s.models.Users.GetTokenVersion)
+	if err != nil {
+		return types.Token{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL)
+
 	claims := &JWTCustomClaims{
-		UserName: userName,
-		UserID:   userID,
+		UserName:     userName,
+		UserID:       userID,
+		TokenVersion: version,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 72)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	}
 
@@ -38,8 +227,46 @@ func (s *Services) UserLogin(c echo.Context) (string, error) {
 
 	t, err := token.SignedString([]byte(s.jwtSecret))
 	if err != nil {
-		return "", err
+		return types.Token{}, err
 	}
 
-	return t, nil
+	return types.Token{Token: t, Username: userName, ExpiresAt: expiresAt}, nil
+}
+
+func (s *Services) newRefreshToken(userName string) (types.Token, error) {
+	token, err := randomToken()
+	if err != nil {
+		return types.Token{}, err
+	}
+
+	return types.Token{Token: token, Username: userName, ExpiresAt: time.Now().Add(RefreshTokenTTL)}, nil
+}
+
+// RegisterUser creates the inactive account sent by the sign up form and
+// emails it the verification link. Invalid or taken values are returned as
+// types.ValidationErrors.
+func (s *Services) RegisterUser(c echo.Context) error {
+	registration := types.Registration{
+		UserName:             c.FormValue("user_name"),
+		Email:                strings.ToLower(strings.TrimSpace(c.FormValue("email"))),
+		Password:             c.FormValue("password"),
+		PasswordConfirmation: c.FormValue("password_confirmation"),
+	}
+
+	if errs := registration.Validate(); len(errs) > 0 {
+		return errs
+	}
+
+	userID, err := s.models.Users.Insert(registration.UserName, registration.Email, registration.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateUserName):
+			return types.ValidationErrors{{Field: "user_name", Constraint: types.ConstraintUnique, Message: "user name is already taken"}}
+		case errors.Is(err, models.ErrDuplicateEmail):
+			return types.ValidationErrors{{Field: "email", Constraint: types.ConstraintUnique, Message: "email is already registered"}}
+		}
+		return err
+	}
+
+	return s.SendVerification(userID)
 }
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+)
+
+// JobSendVerification emails a new user the link that activates the account.
+// Its payload is a types.UserJob.
+const JobSendVerification = "send_verification"
+
+// VerificationTokenMaxAge is how long the link of a verification email works.
+const VerificationTokenMaxAge = 48 * time.Hour
+
+// verificationResendLimit bounds the emails resent to an address, so the
+// resend form can't be used to flood someone's inbox.
+var verificationResendLimit = types.RateLimit{PerMinute: 0.2, Burst: 2}
+
+var (
+	ErrInvalidVerificationToken = errors.New("services: invalid verification link")
+	ErrExpiredVerificationToken = errors.New("services: expired verification link")
+)
+
+// VerificationEmail is the data of the users-verify email template.
+type VerificationEmail struct {
+	UserName  string
+	Link      string
+	ExpiresIn time.Duration
+}
+
+// newVerificationToken returns a signed token that activates userID while
+// its email is still email. Its payload is "<user id>.<unix expiry>.<email>".
+func (s *Services) newVerificationToken(userID int, email string, expiresAt time.Time) string {
+	return s.verifyTokens.Sign(fmt.Sprintf("%d.%d.%s", userID, expiresAt.Unix(), email))
+}
+
+// VerifyEmail activates the account of a verification token.
+func (s *Services) VerifyEmail(token string) error {
+	payload, err := s.verifyTokens.Verify(token)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	parts := strings.SplitN(payload, ".", 3)
+	if len(parts) != 3 {
+		return ErrInvalidVerificationToken
+	}
+	userID, errID := strconv.Atoi(parts[0])
+	expiresAt, errTime := strconv.ParseInt(parts[1], 10, 64)
+	if errID != nil || errTime != nil {
+		return ErrInvalidVerificationToken
+	}
+	if time.Now().After(time.Unix(expiresAt, 0)) {
+		return ErrExpiredVerificationToken
+	}
+
+	user, err := s.models.Users.Get(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+	// The link was sent to another address.
+	if user.Email != parts[2] {
+		return ErrInvalidVerificationToken
+	}
+
+	return s.models.Users.Activate(userID)
+}
+
+// SendVerification queues the verification email of a user.
+func (s *Services) SendVerification(userID int) error {
+	_, err := s.Jobs.Enqueue(JobSendVerification, types.UserJob{UserID: userID})
+	return err
+}
+
+// ResendVerification queues a new verification email for the account with
+// email, if there's one that isn't active yet. It doesn't tell whether
+// there is, so it can't be used to find out who has an account.
+func (s *Services) ResendVerification(email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !types.IsEmail(email) {
+		return nil
+	}
+	if ok, _ := s.rateLimiter.Allow(RateCheck{Key: "verify:" + email, Limit: verificationResendLimit}); !ok {
+		return nil
+	}
+
+	userID, err := s.models.Users.GetIDByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	return s.SendVerification(userID)
+}
+
+func (s *Services) handleSendVerification(ctx context.Context, job types.Job) error {
+	var payload types.UserJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	user, err := s.models.Users.Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+	if user.IsActive || user.Email == "" {
+		return nil
+	}
+
+	token := s.newVerificationToken(payload.UserID, user.Email, time.Now().Add(VerificationTokenMaxAge))
+	msg, err := s.TemplateManager.ExecuteEmail("users-verify.tmpl.html", VerificationEmail{
+		UserName:  user.UserName,
+		Link:      s.baseURL + "/users/verify?token=" + url.QueryEscape(token),
+		ExpiresIn: VerificationTokenMaxAge,
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.From = s.mailSender
+	msg.To = []string{user.Email}
+	return s.mailer.Send(msg)
+}
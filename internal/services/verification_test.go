@@ -0,0 +1,119 @@
+package services
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingMailer keeps the messages instead of sending them.
+type recordingMailer struct {
+	sent []Message
+}
+
+func (m *recordingMailer) Send(msg Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestEmailVerification(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	tm, err := NewTemplateManager(false, e)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	mailer := &recordingMailer{}
+	s := &Services{
+		models:          m,
+		e:               e,
+		baseURL:         "https://formy.example.com",
+		verifyTokens:    NewSigner("secret", "formy email verification"),
+		rateLimiter:     NewRateLimiter(0),
+		mailer:          mailer,
+		TemplateManager: tm,
+		Jobs:            NewJobQueue(m.Jobs, 1, e),
+	}
+	s.Jobs.Handle(JobSendVerification, s.handleSendVerification)
+
+	userID, err := m.Users.Insert("ana_lopez", "ana@example.com", "tortuga-azul-42")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = m.Users.Authenticate("ana_lopez", "tortuga-azul-42")
+	assert.ErrorIs(t, err, models.ErrInactiveAccount)
+
+	_, err = m.Users.Authenticate("ana_lopez", "wrong-password-1")
+	assert.ErrorIs(t, err, models.ErrInvalidCredentials)
+
+	t.Run("Bad tokens are refused", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			token    string
+			expected error
+		}{
+			{name: "Garbage", token: "nope", expected: ErrInvalidVerificationToken},
+			{name: "Other signer", token: NewSigner("other", "formy email verification").Sign("1.9999999999.ana@example.com"), expected: ErrInvalidVerificationToken},
+			{name: "Expired", token: s.newVerificationToken(userID, "ana@example.com", time.Now().Add(-time.Minute)), expected: ErrExpiredVerificationToken},
+			{name: "Other email", token: s.newVerificationToken(userID, "old@example.com", time.Now().Add(time.Hour)), expected: ErrInvalidVerificationToken},
+			{name: "Unknown user", token: s.newVerificationToken(999, "ana@example.com", time.Now().Add(time.Hour)), expected: ErrInvalidVerificationToken},
+		}
+
+		for _, tt := range tests {
+			assert.ErrorIs(t, s.VerifyEmail(tt.token), tt.expected, tt.name)
+		}
+	})
+
+	t.Run("Resends are limited per address", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, s.ResendVerification("ANA@example.com "))
+		}
+		assert.NoError(t, s.ResendVerification("nobody@example.com"))
+
+		for s.Jobs.runNext() {
+		}
+		assert.Len(t, mailer.sent, verificationResendLimit.Burst)
+	})
+
+	t.Run("The emailed link activates the account", func(t *testing.T) {
+		if !assert.NotEmpty(t, mailer.sent) {
+			return
+		}
+		msg := mailer.sent[0]
+		assert.Equal(t, []string{"ana@example.com"}, msg.To)
+
+		link := regexp.MustCompile(`https://formy\.example\.com/users/verify\?token=\S+`).FindString(msg.Text)
+		u, err := url.Parse(link)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NoError(t, s.VerifyEmail(u.Query().Get("token")))
+
+		id, err := m.Users.Authenticate("ana_lopez", "tortuga-azul-42")
+		assert.NoError(t, err)
+		assert.Equal(t, userID, id)
+
+		// Active accounts aren't sent more emails.
+		sent := len(mailer.sent)
+		assert.NoError(t, s.SendVerification(userID))
+		assert.True(t, s.Jobs.runNext())
+		assert.Len(t, mailer.sent, sent)
+	})
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+)
+
+const (
+	// JobDispatchWebhooks creates a delivery of a new submission for every
+	// webhook of its form. Its payload is a types.SubmissionJob.
+	JobDispatchWebhooks = "dispatch_webhooks"
+	// JobDeliverWebhook sends a delivery. Its payload is a
+	// types.WebhookDeliveryJob.
+	JobDeliverWebhook = "deliver_webhook"
+)
+
+const (
+	// WebhookSignatureHeader carries "t=<unix time>,v1=<signature>", see
+	// SignWebhook.
+	WebhookSignatureHeader = "X-Formy-Signature"
+	WebhookEventHeader     = "X-Formy-Event"
+	WebhookDeliveryHeader  = "X-Formy-Delivery"
+
+	webhookTimeout = 10 * time.Second
+	// maxResponseExcerpt is how much of the receiver's response is kept.
+	maxResponseExcerpt = 1024
+)
+
+// newWebhookClient doesn't follow redirects, so deliveries only go to the
+// configured URL. It also refuses to connect to private addresses; they're
+// checked when dialing, so a host name can't resolve to one either.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   webhookTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   webhookDialControl,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the webhook, hiding its address.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookDialControl runs before every connection of the webhook client,
+// with the address about to be dialed.
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	return types.CheckWebhookAddr(addrPort.Addr())
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with the webhook secret. Receivers compute it again to check a delivery
+// and use the timestamp to reject old ones.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// CreateWebhook adds a webhook to one of the user's forms, with a new
+// secret.
+func (s *Services) CreateWebhook(userID, formID int, url string) (types.Webhook, error) {
+	url = strings.TrimSpace(url)
+	if err := types.ValidateWebhookURL(url); err != nil {
+		return types.Webhook{}, types.ValidationErrors{{Field: "url", Message: err.Error()}}
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return types.Webhook{}, err
+	}
+
+	id, err := s.models.Webhooks.Insert(userID, formID, url, secret)
+	if err != nil {
+		return types.Webhook{}, err
+	}
+
+	return s.models.Webhooks.Get(userID, id)
+}
+
+// SendTestEvent sends a test event to one of the user's webhooks. It
+// returns the ID of the delivery.
+func (s *Services) SendTestEvent(userID, webhookID int) (int, error) {
+	webhook, err := s.models.Webhooks.Get(userID, webhookID)
+	if err != nil {
+		return 0, err
+	}
+
+	form, err := s.models.Forms.Get(webhook.FormID)
+	if err != nil {
+		return 0, err
+	}
+
+	payload, err := json.Marshal(types.WebhookPayload{
+		Event: types.WebhookEventTest,
+		Form:  webhookForm(form),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ids, err := s.models.Webhooks.InsertDeliveries([]types.WebhookDelivery{{
+		WebhookID: webhook.ID,
+		Event:     types.WebhookEventTest,
+		Payload:   payload,
+	}}, JobDeliverWebhook)
+	if err != nil {
+		return 0, err
+	}
+
+	s.Jobs.Wake()
+	return ids[0], nil
+}
+
+// Redeliver sends again the payload of a delivery of one of the user's
+// webhooks, as a new delivery. It returns the ID of the new one.
+func (s *Services) Redeliver(userID, deliveryID int) (int, error) {
+	id, err := s.models.Webhooks.Redeliver(userID, deliveryID, JobDeliverWebhook)
+	if err != nil {
+		return 0, err
+	}
+
+	s.Jobs.Wake()
+	return id, nil
+}
+
+func (s *Services) handleDispatchWebhooks(ctx context.Context, job types.Job) error {
+	var payload types.SubmissionJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	submission, err := s.models.Submissions.GetData(payload.SubmissionID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+	if submission.Status != types.SubmissionStatusAccepted {
+		return nil
+	}
+
+	form, err := s.models.Forms.Get(submission.FormID)
+	if err != nil {
+		if errors.Is(err, models.ErrFormNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	webhooks, err := s.models.Webhooks.GetByFormID(form.ID)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	decodeSubmissionFields(form, submission.Fields)
+	body, err := json.Marshal(types.WebhookPayload{
+		Event:      types.WebhookEventSubmissionCreated,
+		Form:       webhookForm(form),
+		Submission: &submission,
+	})
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]types.WebhookDelivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		deliveries = append(deliveries, types.WebhookDelivery{
+			WebhookID:    webhook.ID,
+			SubmissionID: submission.ID,
+			Event:        types.WebhookEventSubmissionCreated,
+			Payload:      body,
+		})
+	}
+
+	// Deliveries and their jobs are created together, so retrying this job
+	// after a failure doesn't send anything twice.
+	if _, err := s.models.Webhooks.InsertDeliveries(deliveries, JobDeliverWebhook); err != nil {
+		return err
+	}
+	s.Jobs.Wake()
+	return nil
+}
+
+func (s *Services) handleDeliverWebhook(ctx context.Context, job types.Job) error {
+	var payload types.WebhookDeliveryJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	delivery, webhook, err := s.models.Webhooks.GetDelivery(payload.DeliveryID)
+	if err != nil {
+		// The webhook was deleted since.
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	deliveryErr := s.sendDelivery(ctx, webhook, &delivery)
+	if err := s.models.Webhooks.RecordAttempt(delivery); err != nil {
+		return err
+	}
+	return deliveryErr
+}
+
+// sendDelivery posts delivery to webhook and fills in the outcome of the
+// attempt. It returns an error if the delivery has to be retried.
+func (s *Services) sendDelivery(ctx context.Context, webhook types.Webhook, delivery *types.WebhookDelivery) error {
+	fail := func(err error) error {
+		delivery.Status = types.DeliveryStatusFailed
+		delivery.Error = err.Error()
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return fail(err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Formy-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(WebhookSignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, SignWebhook(webhook.Secret, timestamp, delivery.Payload)))
+
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		delivery.StatusCode = 0
+		delivery.ResponseExcerpt = ""
+		return fail(err)
+	}
+	defer resp.Body.Close()
+
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseExcerpt))
+	delivery.StatusCode = resp.StatusCode
+	delivery.ResponseExcerpt = strings.ToValidUTF8(string(excerpt), "")
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fail(fmt.Errorf("webhook answered with status %d", resp.StatusCode))
+	}
+
+	delivery.Status = types.DeliveryStatusSucceeded
+	delivery.Error = ""
+	return nil
+}
+
+func webhookForm(form types.FormData) types.WebhookForm {
+	return types.WebhookForm{
+		ID:          form.ID,
+		Name:        form.Name,
+		Description: form.Description,
+		FormVersion: form.FormVersion,
+	}
+}
+
+// decodeSubmissionFields fills in the type and content of stored fields,
+// which only keep their content as a string, using the form's definition.
+func decodeSubmissionFields(form types.FormData, fields []types.SubmissionField) {
+	for i := range fields {
+		field := &fields[i]
+		field.Content = field.ContentAsString
+
+		idx := form.GetFieldIndex(field.Name)
+		if idx == -1 {
+			continue
+		}
+
+		field.Type = form.Fields[idx].Type
+		if field.Type == "string" {
+			continue
+		}
+
+		var content interface{}
+		if err := json.Unmarshal([]byte(field.ContentAsString), &content); err == nil {
+			field.Content = content
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"formy.fprzg.net/internal/models"
+	"formy.fprzg.net/internal/types"
+	"formy.fprzg.net/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"test"}`)
+	sig := SignWebhook("whsec_1", 1700000000, body)
+
+	assert.Len(t, sig, 64)
+	assert.Equal(t, sig, SignWebhook("whsec_1", 1700000000, body))
+	assert.NotEqual(t, sig, SignWebhook("whsec_2", 1700000000, body))
+	assert.NotEqual(t, sig, SignWebhook("whsec_1", 1700000001, body))
+	assert.NotEqual(t, sig, SignWebhook("whsec_1", 1700000000, []byte(`{"event":"tests"}`)))
+}
+
+func TestDecodeSubmissionFields(t *testing.T) {
+	form := types.FormData{Fields: []types.FormField{
+		{Name: "name", Type: "string"},
+		{Name: "age", Type: "number"},
+		{Name: "tags", Type: "array"},
+	}}
+	fields := []types.SubmissionField{
+		{Name: "name", ContentAsString: "Ana"},
+		{Name: "age", ContentAsString: "31"},
+		{Name: "tags", ContentAsString: `["a","b"]`},
+		{Name: "removed", ContentAsString: "old"},
+	}
+
+	decodeSubmissionFields(form, fields)
+
+	assert.Equal(t, "Ana", fields[0].Content)
+	assert.Equal(t, "string", fields[0].Type)
+	assert.Equal(t, float64(31), fields[1].Content)
+	assert.Equal(t, []interface{}{"a", "b"}, fields[2].Content)
+	assert.Equal(t, "old", fields[3].Content)
+	assert.Equal(t, "", fields[3].Type)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	db, err := utils.NewTestDB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	e := echo.New()
+	m, err := models.Get(db, e, time.Second)
+	assert.NoError(t, err)
+
+	userID, err := models.InsertTestUser(m)
+	assert.NoError(t, err)
+	formIDs, err := models.InsertTestForms(m, userID)
+	assert.NoError(t, err)
+
+	status := http.StatusOK
+	var received *http.Request
+	var receivedBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		fmt.Fprint(w, "received")
+	}))
+	defer receiver.Close()
+
+	// The receiver listens on loopback, which webhooks can't reach, so the
+	// test client takes every request to it whatever the URL.
+	client := newWebhookClient()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, receiver.Listener.Addr().String())
+	}
+	client.Transport = transport
+
+	s := &Services{models: m, e: e, webhookClient: client, Jobs: NewJobQueue(m.Jobs, 1, e)}
+	s.Jobs.Handle(JobDeliverWebhook, s.handleDeliverWebhook)
+
+	t.Run("Invalid URLs are rejected", func(t *testing.T) {
+		_, err := s.CreateWebhook(userID, formIDs[0], "ftp://example.com")
+		assert.ErrorAs(t, err, &types.ValidationErrors{})
+	})
+
+	t.Run("Loopback URLs are rejected", func(t *testing.T) {
+		_, err := s.CreateWebhook(userID, formIDs[0], receiver.URL)
+		assert.ErrorAs(t, err, &types.ValidationErrors{})
+
+		// Host names resolving to loopback are caught when dialing.
+		_, err = newWebhookClient().Get(strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1))
+		assert.ErrorIs(t, err, types.ErrPrivateWebhookAddress)
+		assert.Nil(t, received)
+	})
+
+	t.Run("Only owners add webhooks", func(t *testing.T) {
+		_, err := s.CreateWebhook(userID+1, formIDs[0], "http://hooks.example.com/formy")
+		assert.ErrorIs(t, err, models.ErrFormNotFound)
+	})
+
+	webhook, err := s.CreateWebhook(userID, formIDs[0], "http://hooks.example.com/formy")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("Deliveries are signed", func(t *testing.T) {
+		deliveryID, err := s.SendTestEvent(userID, webhook.ID)
+		assert.NoError(t, err)
+		assert.True(t, s.Jobs.runNext())
+
+		if !assert.NotNil(t, received) {
+			return
+		}
+		assert.Equal(t, types.WebhookEventTest, received.Header.Get(WebhookEventHeader))
+		assert.Equal(t, fmt.Sprint(deliveryID), received.Header.Get(WebhookDeliveryHeader))
+
+		var ts int64
+		var sig string
+		_, err = fmt.Sscanf(received.Header.Get(WebhookSignatureHeader), "t=%d,v1=%s", &ts, &sig)
+		assert.NoError(t, err)
+		assert.Equal(t, SignWebhook(webhook.Secret, ts, receivedBody), sig)
+
+		var payload types.WebhookPayload
+		assert.NoError(t, json.Unmarshal(receivedBody, &payload))
+		assert.Equal(t, formIDs[0], payload.Form.ID)
+
+		deliveries, err := m.Webhooks.GetDeliveries(userID, webhook.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, deliveries, 1) {
+			assert.Equal(t, types.DeliveryStatusSucceeded, deliveries[0].Status)
+			assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+			assert.Equal(t, "received", deliveries[0].ResponseExcerpt)
+			assert.NotEmpty(t, deliveries[0].DeliveredAt)
+		}
+	})
+
+	t.Run("Failed deliveries are retried and can be redelivered", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		_, err := s.SendTestEvent(userID, webhook.ID)
+		assert.NoError(t, err)
+		assert.True(t, s.Jobs.runNext())
+
+		deliveries, err := m.Webhooks.GetDeliveries(userID, webhook.ID)
+		assert.NoError(t, err)
+		if !assert.Len(t, deliveries, 2) {
+			return
+		}
+		failed := deliveries[0]
+		assert.Equal(t, types.DeliveryStatusFailed, failed.Status)
+		assert.Equal(t, http.StatusInternalServerError, failed.StatusCode)
+
+		pending, err := m.Jobs.GetByStatus(types.JobStatusPending)
+		assert.NoError(t, err)
+		assert.Len(t, pending, 1)
+
+		_, err = s.Redeliver(userID+1, failed.ID)
+		assert.ErrorIs(t, err, models.ErrNoRecord)
+
+		status = http.StatusOK
+		newID, err := s.Redeliver(userID, failed.ID)
+		assert.NoError(t, err)
+		assert.True(t, s.Jobs.runNext())
+
+		redelivered, _, err := m.Webhooks.GetDelivery(newID)
+		assert.NoError(t, err)
+		assert.Equal(t, types.DeliveryStatusSucceeded, redelivered.Status)
+		assert.JSONEq(t, string(failed.Payload), string(redelivered.Payload))
+	})
+}
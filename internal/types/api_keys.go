@@ -0,0 +1,80 @@
+package types
+
+import (
+	"slices"
+	"strings"
+)
+
+// Scopes of API keys. Sessions opened by logging in have all of them.
+const (
+	ScopeFormsRead         = "forms:read"
+	ScopeFormsWrite        = "forms:write"
+	ScopeSubmissionsRead   = "submissions:read"
+	ScopeSubmissionsDelete = "submissions:delete"
+)
+
+// APIKeyScopes lists every scope, in the order they're shown.
+var APIKeyScopes = []string{ScopeFormsRead, ScopeFormsWrite, ScopeSubmissionsRead, ScopeSubmissionsDelete}
+
+// MaxAPIKeyNameLength bounds the names of API keys.
+const MaxAPIKeyNameLength = 64
+
+// APIKey is a key its user sends as a bearer token to call the API. Only a
+// hash of the key is stored; Prefix is enough to recognize it.
+type APIKey struct {
+	ID         int      `json:"id"`
+	UserID     int      `json:"-"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// HasScope reports whether the key grants scope.
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// ParseScopes splits a space separated list of scopes.
+func ParseScopes(s string) []string {
+	return strings.Fields(s)
+}
+
+// NewAPIKey is what the API key form sends. ExpiresInDays is 0 for keys that
+// don't expire.
+type NewAPIKey struct {
+	Name          string
+	Scopes        []string
+	ExpiresInDays int
+}
+
+func (k NewAPIKey) Validate() ValidationErrors {
+	var errs ValidationErrors
+	add := func(field, constraint, msg string) {
+		errs = append(errs, FieldError{Field: field, Constraint: constraint, Message: msg})
+	}
+
+	name := strings.TrimSpace(k.Name)
+	if name == "" {
+		add("name", ConstraintRequired, "field is required")
+	} else if len(name) > MaxAPIKeyNameLength {
+		add("name", ConstraintType, "name is too long")
+	}
+
+	if len(k.Scopes) == 0 {
+		add("scopes", ConstraintRequired, "choose at least one scope")
+	}
+	for _, scope := range k.Scopes {
+		if !slices.Contains(APIKeyScopes, scope) {
+			add("scopes", ConstraintType, "unknown scope "+scope)
+		}
+	}
+
+	if k.ExpiresInDays < 0 {
+		add("expires_in_days", ConstraintType, "must be 0 or more days")
+	}
+
+	return errs
+}
@@ -0,0 +1,34 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAPIKeyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    NewAPIKey
+		fields []string
+	}{
+		{name: "Valid", key: NewAPIKey{Name: "CI", Scopes: []string{ScopeFormsRead, ScopeFormsWrite}}},
+		{name: "Expires", key: NewAPIKey{Name: "CI", Scopes: []string{ScopeSubmissionsRead}, ExpiresInDays: 30}},
+		{name: "Blank name", key: NewAPIKey{Name: "  ", Scopes: []string{ScopeFormsRead}}, fields: []string{"name"}},
+		{name: "Long name", key: NewAPIKey{Name: strings.Repeat("a", 65), Scopes: []string{ScopeFormsRead}}, fields: []string{"name"}},
+		{name: "No scopes", key: NewAPIKey{Name: "CI"}, fields: []string{"scopes"}},
+		{name: "Unknown scope", key: NewAPIKey{Name: "CI", Scopes: []string{"users:write"}}, fields: []string{"scopes"}},
+		{name: "Negative expiry", key: NewAPIKey{Name: "CI", Scopes: []string{ScopeFormsRead}, ExpiresInDays: -1}, fields: []string{"expires_in_days"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, fe := range tt.key.Validate() {
+				fields = append(fields, fe.Field)
+			}
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
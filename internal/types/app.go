@@ -3,6 +3,8 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"regexp"
 	"time"
 )
 
@@ -12,10 +14,43 @@ import (
 //
 // //////////////////////////////////////////////////////
 type AppConfig struct {
-	Port      string
-	Env       string
-	DBDir     string
-	JWTSecret string
+	Port        string
+	Env         string
+	DBDir       string
+	JWTSecret   string
+	TimeLayouts []string
+	RateLimits  RateLimitConfig
+	// TrustedProxies are the networks whose X-Forwarded-For headers are
+	// believed. With none, the peer address is always the client IP.
+	TrustedProxies []*net.IPNet
+	Mail           MailConfig
+	// JobWorkers is how many background jobs run at the same time.
+	JobWorkers int
+	// BaseURL is where the app is reached from outside, used in the links of
+	// the emails sent, e.g. "https://formy.fprzg.net".
+	BaseURL string
+}
+
+// MailConfig is how notification emails are sent. Without an SMTP host they
+// are written to Dir, or only logged when Dir is empty too.
+type MailConfig struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	// Sender is the From address of every email.
+	Sender string
+	Dir    string
+}
+
+// RateLimitConfig holds the default submission limits, applied to every
+// client IP, to every form and to every client IP on each form.
+type RateLimitConfig struct {
+	PerIP     RateLimit
+	PerForm   RateLimit
+	PerIPForm RateLimit
+	// IdleTimeout is how long a bucket is kept after its last request.
+	IdleTimeout time.Duration
 }
 
 // //////////////////////////////////////////////////////
@@ -47,16 +82,85 @@ type UserData struct {
 //
 // //////////////////////////////////////////////////////
 type FormData struct {
-	UserID      int         `json:"user_id"`
-	ID          int         `json:"id"`
-	Name        string      `json:"name"`
-	Description string      `json:"description,omitempty"`
-	CreatedAt   string      `json:"created_at"`
-	UpdatedAt   string      `json:"last_modified"`
-	FormVersion int         `json:"form_version"`
-	Fields      []FormField `json:"fields"`
+	UserID      int          `json:"user_id"`
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	CreatedAt   string       `json:"created_at"`
+	UpdatedAt   string       `json:"last_modified"`
+	FormVersion int          `json:"form_version"`
+	Fields      []FormField  `json:"fields"`
+	Settings    FormSettings `json:"settings"`
 }
 
+// FormPatch is a partial update of a form. Nil members are left as they are.
+type FormPatch struct {
+	Name        *string       `json:"name"`
+	Description *string       `json:"description"`
+	Fields      []FormField   `json:"fields"`
+	Settings    *FormSettings `json:"settings"`
+}
+
+// FormSettings holds per form options that aren't part of the fields, stored
+// as JSON in forms.settings.
+type FormSettings struct {
+	// SuccessMessage is shown on the thank-you page after a submission.
+	SuccessMessage string `json:"success_message,omitempty"`
+	// SuccessRedirect, when set, replaces the thank-you page. It can be an
+	// absolute http(s) URL or a path on this site.
+	SuccessRedirect string `json:"success_redirect,omitempty"`
+	// Honeypots are the names of hidden inputs added to the rendered form.
+	// People never fill them, so submissions that do are stored as spam.
+	Honeypots []string `json:"honeypots,omitempty"`
+	// TokenPolicy decides what happens to submissions without a valid render
+	// token: "flag" stores them as spam and "reject" refuses them. Tokens
+	// aren't checked when it's empty.
+	TokenPolicy string `json:"token_policy,omitempty"`
+	// MinFillSeconds is the minimum time between rendering the form and
+	// submitting it.
+	MinFillSeconds int `json:"min_fill_seconds,omitempty"`
+	// MaxTokenAgeSeconds is how long a rendered form can be submitted, 24
+	// hours when it's 0.
+	MaxTokenAgeSeconds int `json:"max_token_age_seconds,omitempty"`
+	// RateLimits overrides the server wide submission limits for this form.
+	RateLimits FormRateLimits `json:"rate_limits"`
+	// IPMode is how the client IP is kept in the submission metadata: "raw"
+	// (the default when it's empty), "truncated" or "hashed".
+	IPMode string `json:"ip_mode,omitempty"`
+	// UnexpectedFields is what happens to submitted fields the form doesn't
+	// have: "ignore" drops them, "store" (the default when it's empty) keeps
+	// them apart and "reject" refuses the submission. Both of the latter
+	// record an incident.
+	UnexpectedFields string `json:"unexpected_fields,omitempty"`
+	// Notify sends an email to NotifyEmails for every accepted submission.
+	Notify       bool     `json:"notify,omitempty"`
+	NotifyEmails []string `json:"notify_emails,omitempty"`
+}
+
+// FormRateLimits are the limits a form can override. Nil ones keep the
+// server defaults.
+type FormRateLimits struct {
+	PerForm   *RateLimit `json:"per_form,omitempty"`
+	PerIPForm *RateLimit `json:"per_ip_form,omitempty"`
+}
+
+const (
+	TokenPolicyFlag   = "flag"
+	TokenPolicyReject = "reject"
+)
+
+const (
+	UnexpectedFieldsIgnore = "ignore"
+	UnexpectedFieldsStore  = "store"
+	UnexpectedFieldsReject = "reject"
+)
+
+const (
+	IPModeRaw       = "raw"
+	IPModeTruncated = "truncated"
+	IPModeHashed    = "hashed"
+)
+
 func (fd *FormData) GetFieldIndex(fieldName string) int {
 	for idx, fieldDesc := range fd.Fields {
 		if fieldDesc.Name == fieldName {
@@ -71,12 +175,75 @@ type FormField struct {
 	Name        string            `json:"field_name"`
 	Type        string            `json:"field_type"`
 	Constraints []FieldConstraint `json:"field_constraints"`
+	Rules       []FieldRule       `json:"field_rules,omitempty"`
+}
+
+// Choices returns the options of the field's "choices" constraint, if any.
+func (ff *FormField) Choices() []ChoiceOption {
+	for _, c := range ff.Constraints {
+		if c.Name == ConstraintChoices {
+			return c.Choices
+		}
+	}
+	return nil
 }
 
 type FieldConstraint struct {
-	Name string      `json:"constraint_name"`
-	Min  interface{} `json:"min,omitempty"`
-	Max  interface{} `json:"max,omitempty"`
+	Name    string         `json:"constraint_name"`
+	Min     interface{}    `json:"min,omitempty"`
+	Max     interface{}    `json:"max,omitempty"`
+	Values  []string       `json:"values,omitempty"`
+	Choices []ChoiceOption `json:"choices,omitempty"`
+	Pattern string         `json:"pattern,omitempty"`
+
+	// Regexp caches the compiled Pattern. It's never stored; see
+	// CompilePattern.
+	Regexp *regexp.Regexp `json:"-"`
+}
+
+// ChoiceOption is one of the values accepted by a "choices" constraint. The
+// label is only used when rendering the option.
+type ChoiceOption struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+}
+
+func (co ChoiceOption) DisplayLabel() string {
+	if co.Label == "" {
+		return co.Value
+	}
+	return co.Label
+}
+
+// UnmarshalJSON accepts both {"value": "x", "label": "X"} objects and bare
+// strings or numbers, which are used as the value.
+func (co *ChoiceOption) UnmarshalJSON(data []byte) error {
+	var value json.Number
+	if err := json.Unmarshal(data, &value); err == nil {
+		co.Value = value.String()
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		co.Value = s
+		return nil
+	}
+
+	var raw struct {
+		Value interface{} `json:"value"`
+		Label string      `json:"label"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Value == nil {
+		return fmt.Errorf("choice without value: %s", data)
+	}
+
+	co.Value = fmt.Sprint(raw.Value)
+	co.Label = raw.Label
+	return nil
 }
 
 /*
@@ -143,7 +310,8 @@ func (fc *FieldConstraint) UnmarshalJSON(data []byte) error {
 			}
 			fc.Max = v
 		}
-	} else if fc.Name == "strlen" {
+	} else if fc.Name == "strlen" || fc.Name == ConstraintMaxSize || fc.Name == ConstraintMaxCount ||
+		fc.Name == ConstraintMinItems || fc.Name == ConstraintMaxItems {
 		parseValue := func(rawVal json.RawMessage) (interface{}, error) {
 			var i int
 			if err := json.Unmarshal(rawVal, &i); err == nil {
@@ -168,18 +336,88 @@ func (fc *FieldConstraint) UnmarshalJSON(data []byte) error {
 			}
 			fc.Max = v
 		}
+	} else if fc.Name == ConstraintMime {
+		if rawValues, ok := raw["values"]; ok {
+			if err := json.Unmarshal(rawValues, &fc.Values); err != nil {
+				return err
+			}
+		}
+	} else if fc.Name == ConstraintPattern {
+		if rawPattern, ok := raw["pattern"]; ok {
+			if err := json.Unmarshal(rawPattern, &fc.Pattern); err != nil {
+				return err
+			}
+		}
+	} else if fc.Name == ConstraintChoices {
+		// Forms created before labels existed listed plain "values".
+		rawChoices, ok := raw["choices"]
+		if !ok {
+			rawChoices, ok = raw["values"]
+		}
+
+		if ok {
+			if err := json.Unmarshal(rawChoices, &fc.Choices); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+const (
+	SubmissionStatusAccepted = "accepted"
+	// SubmissionStatusSpam marks quarantined submissions, kept apart until
+	// the owner reviews them.
+	SubmissionStatusSpam = "spam"
+)
+
 type SubmissionData struct {
 	ID             int               `json:"id"`
 	FormID         int               `json:"form_id"`
 	FormInstanceID int               `json:"form_instance_id"`
+	Status         string            `json:"status"`
 	Metadata       string            `json:"metadata"`
 	SubmittedAt    string            `json:"submitted_at"`
 	Fields         []SubmissionField `json:"fields"`
+	Files          []SubmissionFile  `json:"files,omitempty"`
+	// UnexpectedFields are the fields sent that the form doesn't have, kept
+	// when its policy is to store them.
+	UnexpectedFields []UnexpectedField `json:"unexpected_fields,omitempty"`
+	// Token is the render token the submission came with, used up when it's
+	// stored.
+	Token *FormToken `json:"-"`
+}
+
+// FormToken is a verified render token, identified by its nonce.
+type FormToken struct {
+	Nonce     string
+	FormID    int
+	ExpiresAt time.Time
+}
+
+// UnexpectedField is a submitted field the form doesn't have. Content is the
+// value sent, or a JSON list when there were several values or files.
+type UnexpectedField struct {
+	Name    string `json:"field_name"`
+	Content string `json:"content"`
+}
+
+const IncidentUnexpectedFields = "unexpected_fields"
+
+// Incident records something about a submission the form owner should know,
+// e.g. that it had fields the form doesn't have.
+type Incident struct {
+	ID       int    `json:"id"`
+	FormID   int    `json:"form_id"`
+	FormName string `json:"form_name,omitempty"`
+	// SubmissionID is 0 when the submission was rejected or deleted.
+	SubmissionID int    `json:"submission_id,omitempty"`
+	Kind         string `json:"kind"`
+	// Policy is the form's policy when the incident happened.
+	Policy    string   `json:"policy"`
+	Fields    []string `json:"fields"`
+	CreatedAt string   `json:"created_at"`
 }
 
 type SubmissionField struct {
@@ -187,8 +425,22 @@ type SubmissionField struct {
 	Type            string      `json:"field_type"`
 	Content         interface{} `json:"field_content"`
 	ContentAsString string      `json:"content_as_string"`
-	Hash            string
-	Unique          bool
+	// Hash and Unique are only used to claim unique values on insert.
+	Hash   string `json:"-"`
+	Unique bool   `json:"-"`
+}
+
+// SubmissionFile describes an uploaded file. The content lives in the blob
+// store under Hash; only its metadata is kept in the database.
+type SubmissionFile struct {
+	ID           int    `json:"id"`
+	SubmissionID int    `json:"submission_id"`
+	FieldName    string `json:"field_name"`
+	FileName     string `json:"file_name"`
+	MimeType     string `json:"mime_type"`
+	Size         int64  `json:"size"`
+	Hash         string `json:"-"`
+	CreatedAt    string `json:"created_at"`
 }
 
 /*
@@ -215,7 +467,14 @@ func (fd *SubmissionField) UnmarshalJSON(data []byte) error {
 		}
 	}
 
-	if contentRaw, ok := raw["content"]; ok {
+	contentRaw, ok := raw["content"]
+	if !ok {
+		contentRaw, ok = raw["field_content"]
+	}
+
+	// Dates are kept as strings; they get parsed once the declared field
+	// type is known (see CoerceValue).
+	if ok {
 		var i int
 		if err := json.Unmarshal(contentRaw, &i); err == nil {
 			fd.Content = i
@@ -228,12 +487,6 @@ func (fd *SubmissionField) UnmarshalJSON(data []byte) error {
 			return nil
 		}
 
-		var t time.Time
-		if err := json.Unmarshal(contentRaw, &t); err == nil {
-			fd.Content = t
-			return nil
-		}
-
 		var s string
 		if err := json.Unmarshal(contentRaw, &s); err == nil {
 			fd.Content = s
@@ -0,0 +1,220 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeLayouts are tried in order when a submitted value has to be
+// parsed as a time.Time and no other layouts were configured. They cover
+// RFC 3339 plus what the date and datetime-local HTML inputs send.
+var DefaultTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// CoerceValue converts a submitted value into the Go type declared by
+// fieldType. Values coming from urlencoded forms are always strings, while
+// JSON bodies may already carry numbers and booleans.
+func CoerceValue(value interface{}, fieldType string, timeLayouts []string) (interface{}, error) {
+	if value == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	if elemType, ok := ListElemType(fieldType); ok {
+		return coerceList(value, elemType, timeLayouts)
+	}
+
+	if n, ok := value.(json.Number); ok {
+		value = n.String()
+	}
+
+	switch fieldType {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string but received '%v'", value)
+		}
+		return s, nil
+
+	case "int":
+		i, err := coerceInt(value, strconv.IntSize)
+		if err != nil {
+			return nil, err
+		}
+		return int(i), nil
+
+	case "int64":
+		return coerceInt(value, 64)
+
+	case "float64":
+		return coerceFloat(value)
+
+	case "bool":
+		return coerceBool(value)
+
+	case "time.Time":
+		return coerceTime(value, timeLayouts)
+
+	default:
+		if TypesMatch(value, fieldType) {
+			return value, nil
+		}
+		return nil, fmt.Errorf("unsupported field type '%s'", fieldType)
+	}
+}
+
+// ListElemType returns the element type of list field types such as
+// "[]string", which hold every value submitted for the field.
+func ListElemType(fieldType string) (string, bool) {
+	elemType, ok := strings.CutPrefix(fieldType, "[]")
+	if !ok || elemType == "" {
+		return "", false
+	}
+	return elemType, true
+}
+
+func coerceList(value interface{}, elemType string, timeLayouts []string) (interface{}, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	switch elemType {
+	case "string":
+		return coerceItems[string](values, elemType, timeLayouts)
+	case "int":
+		return coerceItems[int](values, elemType, timeLayouts)
+	case "int64":
+		return coerceItems[int64](values, elemType, timeLayouts)
+	case "float64":
+		return coerceItems[float64](values, elemType, timeLayouts)
+	case "bool":
+		return coerceItems[bool](values, elemType, timeLayouts)
+	case "time.Time":
+		return coerceItems[time.Time](values, elemType, timeLayouts)
+	}
+
+	return nil, fmt.Errorf("unsupported field type '[]%s'", elemType)
+}
+
+func coerceItems[T any](values []interface{}, elemType string, timeLayouts []string) ([]T, error) {
+	items := make([]T, 0, len(values))
+	for i, v := range values {
+		item, err := CoerceValue(v, elemType, timeLayouts)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", i+1, err)
+		}
+		items = append(items, item.(T))
+	}
+	return items, nil
+}
+
+func coerceInt(value interface{}, bitSize int) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			return 0, fmt.Errorf("'%v' is not a valid integer", v)
+		}
+		// Converting a float out of range gives an implementation-defined
+		// result. The bounds are powers of two, so they're exact floats.
+		limit := math.Ldexp(1, bitSize-1)
+		if v < -limit || v >= limit {
+			return 0, fmt.Errorf("'%v' is out of range for an integer", v)
+		}
+		return int64(v), nil
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, bitSize)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid integer", v)
+		}
+		return i, nil
+	}
+
+	return 0, fmt.Errorf("'%v' is not a valid integer", value)
+}
+
+func coerceFloat(value interface{}) (float64, error) {
+	var f float64
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		f = v
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid number", v)
+		}
+		f = parsed
+	default:
+		return 0, fmt.Errorf("'%v' is not a valid number", value)
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("'%v' is not a valid number", value)
+	}
+
+	return f, nil
+}
+
+func coerceBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "1", "t", "true", "on", "yes":
+			return true, nil
+		case "0", "f", "false", "off", "no":
+			return false, nil
+		}
+		return false, fmt.Errorf("'%s' is not a valid boolean", v)
+	}
+
+	return false, fmt.Errorf("'%v' is not a valid boolean", value)
+}
+
+func coerceTime(value interface{}, layouts []string) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		if t, ok := ParseTime(v, layouts); ok {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("'%s' is not a valid date/time", v)
+	}
+
+	return time.Time{}, fmt.Errorf("'%v' is not a valid date/time", value)
+}
+
+// ParseTime tries every layout in order. Layouts without a time zone are
+// interpreted as UTC. When layouts is empty DefaultTimeLayouts is used.
+func ParseTime(s string, layouts []string) (time.Time, bool) {
+	if len(layouts) == 0 {
+		layouts = DefaultTimeLayouts
+	}
+
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,200 @@
+package types
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		value       interface{}
+		fieldType   string
+		layouts     []string
+		expected    interface{}
+		expectError bool
+	}{
+		{
+			TestName:  "String stays string",
+			value:     "Lucifer",
+			fieldType: "string",
+			expected:  "Lucifer",
+		},
+		{
+			TestName:    "Number is not a string",
+			value:       float64(12),
+			fieldType:   "string",
+			expectError: true,
+		},
+		{
+			TestName:  "Int from form value",
+			value:     " 30 ",
+			fieldType: "int",
+			expected:  30,
+		},
+		{
+			TestName:  "Int from JSON number",
+			value:     float64(30),
+			fieldType: "int",
+			expected:  30,
+		},
+		{
+			TestName:  "Int from json.Number",
+			value:     json.Number("42"),
+			fieldType: "int",
+			expected:  42,
+		},
+		{
+			TestName:    "Int from huge JSON number",
+			value:       float64(1e300),
+			fieldType:   "int64",
+			expectError: true,
+		},
+		{
+			TestName:    "Int from JSON number just past int64",
+			value:       float64(1 << 63),
+			fieldType:   "int64",
+			expectError: true,
+		},
+		{
+			TestName:  "Int64 from smallest JSON number",
+			value:     float64(-1 << 63),
+			fieldType: "int64",
+			expected:  int64(math.MinInt64),
+		},
+		{
+			TestName:    "Int with decimals",
+			value:       "30.5",
+			fieldType:   "int",
+			expectError: true,
+		},
+		{
+			TestName:    "Int from text",
+			value:       "thirty",
+			fieldType:   "int",
+			expectError: true,
+		},
+		{
+			TestName:  "Int64 from form value",
+			value:     "9007199254740993",
+			fieldType: "int64",
+			expected:  int64(9007199254740993),
+		},
+		{
+			TestName:  "Float from form value",
+			value:     "1.75",
+			fieldType: "float64",
+			expected:  1.75,
+		},
+		{
+			TestName:    "Float rejects NaN",
+			value:       "NaN",
+			fieldType:   "float64",
+			expectError: true,
+		},
+		{
+			TestName:  "Bool from checkbox",
+			value:     "on",
+			fieldType: "bool",
+			expected:  true,
+		},
+		{
+			TestName:  "Bool from JSON",
+			value:     false,
+			fieldType: "bool",
+			expected:  false,
+		},
+		{
+			TestName:    "Bool from text",
+			value:       "maybe",
+			fieldType:   "bool",
+			expectError: true,
+		},
+		{
+			TestName:  "Datetime RFC 3339",
+			value:     "2024-04-08T12:00:00Z",
+			fieldType: "time.Time",
+			expected:  time.Date(2024, 4, 8, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			TestName:  "Date input",
+			value:     "2024-04-08",
+			fieldType: "time.Time",
+			expected:  time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			TestName:  "Datetime-local input",
+			value:     "2024-04-08T12:30",
+			fieldType: "time.Time",
+			expected:  time.Date(2024, 4, 8, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			TestName:  "Custom layout",
+			value:     "08/04/2024",
+			fieldType: "time.Time",
+			layouts:   []string{"02/01/2006"},
+			expected:  time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			TestName:    "Custom layout replaces defaults",
+			value:       "2024-04-08",
+			fieldType:   "time.Time",
+			layouts:     []string{"02/01/2006"},
+			expectError: true,
+		},
+		{
+			TestName:  "String list",
+			value:     []interface{}{"a", "b"},
+			fieldType: "[]string",
+			expected:  []string{"a", "b"},
+		},
+		{
+			TestName:  "Single value as list",
+			value:     "a",
+			fieldType: "[]string",
+			expected:  []string{"a"},
+		},
+		{
+			TestName:  "Int list from form values",
+			value:     []interface{}{"1", json.Number("2"), float64(3)},
+			fieldType: "[]int",
+			expected:  []int{1, 2, 3},
+		},
+		{
+			TestName:    "Int list with an invalid item",
+			value:       []interface{}{"1", "two"},
+			fieldType:   "[]int",
+			expectError: true,
+		},
+		{
+			TestName:    "Unknown list type",
+			value:       []interface{}{"a"},
+			fieldType:   "[]unknownType",
+			expectError: true,
+		},
+		{
+			TestName:    "Unknown field type",
+			value:       "hello",
+			fieldType:   "unknownType",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			got, err := CoerceValue(tt.value, tt.fieldType, tt.layouts)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+			assert.True(t, TypesMatch(got, tt.fieldType))
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ConstraintRequired = "required"
+	ConstraintUnique   = "unique"
+	ConstraintEmail    = "email"
+	ConstraintInterval = "interval"
+	ConstraintStrlen   = "strlen"
+	ConstraintMaxSize  = "max_size"
+	ConstraintMime     = "mime"
+	ConstraintMaxCount = "max_count"
+	ConstraintMinItems = "min_items"
+	ConstraintMaxItems = "max_items"
+	ConstraintChoices  = "choices"
+
+	// ConstraintType is not declared by forms; it's used to report values that
+	// don't match the declared field type.
+	ConstraintType = "type"
+)
+
+type FieldError struct {
+	Field      string `json:"field_name"`
+	Constraint string `json:"constraint_name"`
+	Message    string `json:"message"`
+}
+
+type ValidationErrors []FieldError
+
+func (ve ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(ve))
+	for _, fe := range ve {
+		msgs = append(msgs, fmt.Sprintf("'%s': %s", fe.Field, fe.Message))
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func IsEmptyValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	if s, ok := value.(string); ok {
+		return strings.TrimSpace(s) == ""
+	}
+
+	if items, ok := listItems(value); ok {
+		return len(items) == 0
+	}
+
+	return false
+}
+
+// listItems returns the elements of value when it's a slice, as produced by
+// list field types.
+func listItems(value interface{}) ([]interface{}, bool) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, true
+}
+
+// CheckFieldConstraints evaluates every constraint declared on field against
+// value. A nil or empty value only gets checked against "required" and
+// "min_items". The "unique" constraint needs the database, so it's left to the
+// caller.
+func CheckFieldConstraints(field FormField, value interface{}) []FieldError {
+	var errs []FieldError
+
+	if IsEmptyValue(value) {
+		_, isList := ListElemType(field.Type)
+		for _, c := range field.Constraints {
+			if c.Name == ConstraintRequired {
+				errs = append(errs, FieldError{Field: field.Name, Constraint: c.Name, Message: "field is required"})
+			} else if c.Name == ConstraintMinItems && isList {
+				if msg := checkItemCount(c, nil, true); msg != "" {
+					errs = append(errs, FieldError{Field: field.Name, Constraint: c.Name, Message: msg})
+				}
+			}
+		}
+		return errs
+	}
+
+	// Constraints on list fields apply to every item, except the ones about
+	// the list itself.
+	items, isList := listItems(value)
+	if !isList {
+		items = []interface{}{value}
+	}
+
+	for _, c := range field.Constraints {
+		var msg string
+		switch c.Name {
+		case ConstraintMinItems, ConstraintMaxItems:
+			msg = checkItemCount(c, items, isList)
+		default:
+			for _, item := range items {
+				if msg = checkValue(c, item); msg != "" {
+					break
+				}
+			}
+		}
+
+		if msg != "" {
+			errs = append(errs, FieldError{Field: field.Name, Constraint: c.Name, Message: msg})
+		}
+	}
+
+	return errs
+}
+
+func checkValue(c FieldConstraint, value interface{}) string {
+	switch c.Name {
+	case ConstraintEmail, ConstraintURL, ConstraintPhone, ConstraintUUID,
+		ConstraintIPv4, ConstraintIPv6, ConstraintSlug:
+		return checkFormat(c.Name, value)
+	case ConstraintPattern:
+		return checkPattern(c, value)
+	case ConstraintInterval:
+		return checkInterval(c, value)
+	case ConstraintStrlen:
+		return checkStrlen(c, value)
+	case ConstraintChoices:
+		return checkChoices(c, value)
+	}
+	return ""
+}
+
+func checkItemCount(c FieldConstraint, items []interface{}, isList bool) string {
+	if !isList {
+		return fmt.Sprintf("%s constraint only applies to list fields", c.Name)
+	}
+
+	count := float64(len(items))
+	if c.Name == ConstraintMinItems {
+		if min, ok := toFloat(c.Min); ok && count < min {
+			return fmt.Sprintf("at least %v items must be selected", c.Min)
+		}
+	} else {
+		if max, ok := toFloat(c.Max); ok && count > max {
+			return fmt.Sprintf("at most %v items can be selected", c.Max)
+		}
+	}
+
+	return ""
+}
+
+func checkChoices(c FieldConstraint, value interface{}) string {
+	s := fmt.Sprint(value)
+	for _, choice := range c.Choices {
+		if choice.Value == s {
+			return ""
+		}
+	}
+	return fmt.Sprintf("'%s' is not one of the allowed choices", s)
+}
+
+// FieldTypeFile marks a field whose values are uploaded files instead of
+// form values.
+const FieldTypeFile = "file"
+
+type FileInfo struct {
+	Name     string
+	Size     int64
+	MimeType string
+}
+
+// CheckFileConstraints is the counterpart of CheckFieldConstraints for file
+// fields. Unless a "max_count" constraint says otherwise a single file is
+// accepted.
+func CheckFileConstraints(field FormField, files []FileInfo) []FieldError {
+	var errs []FieldError
+	addError := func(c, msg string) {
+		errs = append(errs, FieldError{Field: field.Name, Constraint: c, Message: msg})
+	}
+
+	if len(files) == 0 {
+		for _, c := range field.Constraints {
+			if c.Name == ConstraintRequired {
+				addError(c.Name, "field is required")
+			}
+		}
+		return errs
+	}
+
+	maxCount := 1.0
+	for _, c := range field.Constraints {
+		if max, ok := toFloat(c.Max); c.Name == ConstraintMaxCount && ok {
+			maxCount = max
+		}
+	}
+	if float64(len(files)) > maxCount {
+		addError(ConstraintMaxCount, fmt.Sprintf("at most %v files can be uploaded", maxCount))
+	}
+
+	for _, c := range field.Constraints {
+		switch c.Name {
+		case ConstraintMaxSize:
+			max, ok := toFloat(c.Max)
+			if !ok {
+				continue
+			}
+			for _, f := range files {
+				if float64(f.Size) > max {
+					addError(c.Name, fmt.Sprintf("'%s' exceeds the maximum size of %v bytes", f.Name, c.Max))
+				}
+			}
+
+		case ConstraintMime:
+			for _, f := range files {
+				if !mimeAllowed(f.MimeType, c.Values) {
+					addError(c.Name, fmt.Sprintf("'%s' has a disallowed type '%s'", f.Name, f.MimeType))
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+// mimeAllowed matches mimeType against a list of allowed types, which may use
+// wildcards such as "image/*".
+func mimeAllowed(mimeType string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == mimeType || a == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func checkInterval(c FieldConstraint, value interface{}) string {
+	if c.Min != nil {
+		cmp, ok := compareValues(value, c.Min)
+		if !ok {
+			return fmt.Sprintf("can't compare value with interval minimum %v", c.Min)
+		}
+		if cmp < 0 {
+			return fmt.Sprintf("must be greater than or equal to %v", c.Min)
+		}
+	}
+
+	if c.Max != nil {
+		cmp, ok := compareValues(value, c.Max)
+		if !ok {
+			return fmt.Sprintf("can't compare value with interval maximum %v", c.Max)
+		}
+		if cmp > 0 {
+			return fmt.Sprintf("must be less than or equal to %v", c.Max)
+		}
+	}
+
+	return ""
+}
+
+func checkStrlen(c FieldConstraint, value interface{}) string {
+	s, ok := value.(string)
+	if !ok {
+		return "strlen constraint only applies to strings"
+	}
+
+	length := float64(utf8.RuneCountInString(s))
+
+	if min, ok := toFloat(c.Min); ok && length < min {
+		return fmt.Sprintf("must be at least %v characters long", c.Min)
+	}
+	if max, ok := toFloat(c.Max); ok && length > max {
+		return fmt.Sprintf("must be at most %v characters long", c.Max)
+	}
+
+	return ""
+}
+
+// compareValues returns -1, 0 or 1 when a is less than, equal to or greater
+// than b. The second return value is false when both values aren't comparable.
+func compareValues(a, b interface{}) (int, bool) {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		if s, isString := b.(string); isString {
+			tb, ok = ParseTime(s, nil)
+		}
+		if !ok {
+			return 0, false
+		}
+		return ta.Compare(tb), true
+	}
+
+	if sa, ok := a.(string); ok {
+		sb, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(sa, sb), true
+	}
+
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,248 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFieldConstraints(t *testing.T) {
+	tests := []struct {
+		TestName            string
+		field               FormField
+		value               interface{}
+		expectedConstraints []string
+	}{
+		{
+			TestName:            "Required field missing",
+			field:               FormField{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "required"}}},
+			value:               nil,
+			expectedConstraints: []string{"required"},
+		},
+		{
+			TestName:            "Required field blank",
+			field:               FormField{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "required"}}},
+			value:               "   ",
+			expectedConstraints: []string{"required"},
+		},
+		{
+			TestName:            "Optional field missing skips other constraints",
+			field:               FormField{Name: "email", Type: "string", Constraints: []FieldConstraint{{Name: "email"}}},
+			value:               nil,
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "Valid email",
+			field:               FormField{Name: "email", Type: "string", Constraints: []FieldConstraint{{Name: "required"}, {Name: "email"}}},
+			value:               "lucifer@gmail.com",
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "Invalid email",
+			field:               FormField{Name: "email", Type: "string", Constraints: []FieldConstraint{{Name: "email"}}},
+			value:               "not-an-email",
+			expectedConstraints: []string{"email"},
+		},
+		{
+			TestName:            "Email with display name",
+			field:               FormField{Name: "email", Type: "string", Constraints: []FieldConstraint{{Name: "email"}}},
+			value:               "Lucifer <lucifer@gmail.com>",
+			expectedConstraints: []string{"email"},
+		},
+		{
+			TestName:            "Integer inside interval",
+			field:               FormField{Name: "age", Type: "int", Constraints: []FieldConstraint{{Name: "interval", Min: 0, Max: 150}}},
+			value:               30,
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "Integer above interval",
+			field:               FormField{Name: "age", Type: "int", Constraints: []FieldConstraint{{Name: "interval", Min: 0, Max: 150}}},
+			value:               151,
+			expectedConstraints: []string{"interval"},
+		},
+		{
+			TestName:            "Float below interval",
+			field:               FormField{Name: "height", Type: "float64", Constraints: []FieldConstraint{{Name: "interval", Min: 0.5}}},
+			value:               0.25,
+			expectedConstraints: []string{"interval"},
+		},
+		{
+			TestName: "Datetime inside interval",
+			field: FormField{Name: "date", Type: "time.Time", Constraints: []FieldConstraint{{
+				Name: "interval",
+				Min:  time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				Max:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			}}},
+			value:               time.Date(2024, 4, 8, 12, 0, 0, 0, time.UTC),
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "Incomparable interval bound",
+			field:               FormField{Name: "age", Type: "int", Constraints: []FieldConstraint{{Name: "interval", Min: "a"}}},
+			value:               30,
+			expectedConstraints: []string{"interval"},
+		},
+		{
+			TestName:            "String length inside bounds",
+			field:               FormField{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "strlen", Min: 1, Max: 5}}},
+			value:               "Lucía",
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "String too long",
+			field:               FormField{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "strlen", Max: 3}}},
+			value:               "Lucía",
+			expectedConstraints: []string{"strlen"},
+		},
+		{
+			TestName: "Several failing constraints",
+			field: FormField{Name: "email", Type: "string", Constraints: []FieldConstraint{
+				{Name: "email"},
+				{Name: "strlen", Min: 20},
+			}},
+			value:               "nope",
+			expectedConstraints: []string{"email", "strlen"},
+		},
+		{
+			TestName:            "Allowed choice",
+			field:               FormField{Name: "department", Type: "string", Constraints: []FieldConstraint{{Name: "choices", Choices: []ChoiceOption{{Value: "sales", Label: "Sales"}, {Value: "support"}}}}},
+			value:               "sales",
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "Unknown choice",
+			field:               FormField{Name: "department", Type: "string", Constraints: []FieldConstraint{{Name: "choices", Choices: []ChoiceOption{{Value: "sales", Label: "Sales"}, {Value: "support"}}}}},
+			value:               "marketing",
+			expectedConstraints: []string{"choices"},
+		},
+		{
+			TestName: "List inside item bounds",
+			field: FormField{Name: "tags", Type: "[]string", Constraints: []FieldConstraint{
+				{Name: "min_items", Min: 1},
+				{Name: "max_items", Max: 2},
+				{Name: "choices", Choices: []ChoiceOption{{Value: "a"}, {Value: "b"}, {Value: "c"}}},
+			}},
+			value:               []string{"a", "c"},
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "List with too many items",
+			field:               FormField{Name: "tags", Type: "[]string", Constraints: []FieldConstraint{{Name: "max_items", Max: 2}}},
+			value:               []string{"a", "b", "c"},
+			expectedConstraints: []string{"max_items"},
+		},
+		{
+			TestName:            "Empty list below minimum",
+			field:               FormField{Name: "tags", Type: "[]string", Constraints: []FieldConstraint{{Name: "min_items", Min: 1}}},
+			value:               nil,
+			expectedConstraints: []string{"min_items"},
+		},
+		{
+			TestName:            "List with an unknown choice",
+			field:               FormField{Name: "tags", Type: "[]string", Constraints: []FieldConstraint{{Name: "choices", Choices: []ChoiceOption{{Value: "a"}, {Value: "b"}}}}},
+			value:               []string{"a", "z"},
+			expectedConstraints: []string{"choices"},
+		},
+		{
+			TestName:            "Item constraints apply to every item",
+			field:               FormField{Name: "scores", Type: "[]int", Constraints: []FieldConstraint{{Name: "interval", Min: 0, Max: 10}}},
+			value:               []int{3, 11},
+			expectedConstraints: []string{"interval"},
+		},
+		{
+			TestName:            "Item count on a scalar field",
+			field:               FormField{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "max_items", Max: 2}}},
+			value:               "Lucía",
+			expectedConstraints: []string{"max_items"},
+		},
+		{
+			TestName:            "Unique is left to the caller",
+			field:               FormField{Name: "email", Type: "string", Constraints: []FieldConstraint{{Name: "unique"}}},
+			value:               "a@b.com",
+			expectedConstraints: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			errs := CheckFieldConstraints(tt.field, tt.value)
+
+			var got []string
+			for _, fe := range errs {
+				assert.Equal(t, tt.field.Name, fe.Field)
+				assert.NotEmpty(t, fe.Message)
+				got = append(got, fe.Constraint)
+			}
+			assert.Equal(t, tt.expectedConstraints, got)
+		})
+	}
+}
+
+func TestCheckFileConstraints(t *testing.T) {
+	pdf := FileInfo{Name: "cv.pdf", Size: 2048, MimeType: "application/pdf"}
+	png := FileInfo{Name: "photo.png", Size: 4096, MimeType: "image/png"}
+
+	tests := []struct {
+		TestName            string
+		constraints         []FieldConstraint
+		files               []FileInfo
+		expectedConstraints []string
+	}{
+		{
+			TestName:            "Required file missing",
+			constraints:         []FieldConstraint{{Name: "required"}},
+			files:               nil,
+			expectedConstraints: []string{"required"},
+		},
+		{
+			TestName:            "Single file by default",
+			constraints:         nil,
+			files:               []FileInfo{pdf, png},
+			expectedConstraints: []string{"max_count"},
+		},
+		{
+			TestName:            "Several files allowed",
+			constraints:         []FieldConstraint{{Name: "max_count", Max: 2}},
+			files:               []FileInfo{pdf, png},
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "File too big",
+			constraints:         []FieldConstraint{{Name: "max_size", Max: 3000}},
+			files:               []FileInfo{png},
+			expectedConstraints: []string{"max_size"},
+		},
+		{
+			TestName:            "Allowed mime type",
+			constraints:         []FieldConstraint{{Name: "mime", Values: []string{"application/pdf"}}},
+			files:               []FileInfo{pdf},
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "Wildcard mime type",
+			constraints:         []FieldConstraint{{Name: "mime", Values: []string{"image/*"}}},
+			files:               []FileInfo{png},
+			expectedConstraints: nil,
+		},
+		{
+			TestName:            "Disallowed mime type",
+			constraints:         []FieldConstraint{{Name: "mime", Values: []string{"image/*"}}},
+			files:               []FileInfo{pdf},
+			expectedConstraints: []string{"mime"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			field := FormField{Name: "attachment", Type: FieldTypeFile, Constraints: tt.constraints}
+
+			var got []string
+			for _, fe := range CheckFileConstraints(field, tt.files) {
+				got = append(got, fe.Constraint)
+			}
+			assert.Equal(t, tt.expectedConstraints, got)
+		})
+	}
+}
@@ -109,3 +109,53 @@ func TestFieldData(t *testing.T) {
 		})
 	}
 }
+
+func TestChoicesConstraint(t *testing.T) {
+	tests := []struct {
+		TestName        string
+		constraintJSON  string
+		expectedChoices []ChoiceOption
+	}{
+		{
+			TestName:       "Labeled choices",
+			constraintJSON: `{"constraint_name": "choices", "choices": [{"value": "sales", "label": "Sales"}, {"value": "support", "label": "Customer support"}]}`,
+			expectedChoices: []ChoiceOption{
+				{Value: "sales", Label: "Sales"},
+				{Value: "support", Label: "Customer support"},
+			},
+		},
+		{
+			TestName:       "Bare values",
+			constraintJSON: `{"constraint_name": "choices", "choices": ["sales", 2]}`,
+			expectedChoices: []ChoiceOption{
+				{Value: "sales"},
+				{Value: "2"},
+			},
+		},
+		{
+			TestName:       "Legacy values list",
+			constraintJSON: `{"constraint_name": "choices", "values": ["a", "b"]}`,
+			expectedChoices: []ChoiceOption{
+				{Value: "a"},
+				{Value: "b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			var fc FieldConstraint
+			err := json.Unmarshal([]byte(tt.constraintJSON), &fc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedChoices, fc.Choices)
+
+			field := FormField{Name: "department", Type: "string", Constraints: []FieldConstraint{fc}}
+			assert.Equal(t, tt.expectedChoices, field.Choices())
+			assert.Empty(t, CheckFieldConstraints(field, tt.expectedChoices[0].Value))
+		})
+	}
+
+	var fc FieldConstraint
+	err := json.Unmarshal([]byte(`{"constraint_name": "choices", "choices": [{"label": "No value"}]}`), &fc)
+	assert.Error(t, err)
+}
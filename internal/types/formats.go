@@ -0,0 +1,111 @@
+package types
+
+import (
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+)
+
+const (
+	ConstraintPattern = "pattern"
+	ConstraintURL     = "url"
+	ConstraintPhone   = "phone"
+	ConstraintUUID    = "uuid"
+	ConstraintIPv4    = "ipv4"
+	ConstraintIPv6    = "ipv6"
+	ConstraintSlug    = "slug"
+)
+
+var (
+	phoneRegexp = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	uuidRegexp  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	slugRegexp  = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+)
+
+// CompilePattern compiles the regular expression of a "pattern" constraint.
+// Just like the HTML pattern attribute, it has to match the whole value.
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	// Compile it on its own first so errors mention the user's pattern.
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+func checkPattern(c FieldConstraint, value interface{}) string {
+	s, ok := value.(string)
+	if !ok {
+		return "pattern constraint only applies to strings"
+	}
+
+	re := c.Regexp
+	if re == nil {
+		var err error
+		if re, err = CompilePattern(c.Pattern); err != nil {
+			return fmt.Sprintf("invalid pattern '%s'", c.Pattern)
+		}
+	}
+
+	if !re.MatchString(s) {
+		return "doesn't match the expected format"
+	}
+
+	return ""
+}
+
+// checkFormat validates the built-in formats, which don't need any
+// parameter.
+func checkFormat(format string, value interface{}) string {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Sprintf("%s constraint only applies to strings", format)
+	}
+
+	switch format {
+	case ConstraintEmail:
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s {
+			return "must be a valid email address"
+		}
+
+	case ConstraintURL:
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be a valid http or https URL"
+		}
+
+	case ConstraintPhone:
+		if !phoneRegexp.MatchString(s) {
+			return "must be a phone number in E.164 format, e.g. +5215512345678"
+		}
+
+	case ConstraintUUID:
+		if !uuidRegexp.MatchString(s) {
+			return "must be a valid UUID"
+		}
+
+	case ConstraintIPv4:
+		addr, err := netip.ParseAddr(s)
+		if err != nil || !addr.Is4() {
+			return "must be a valid IPv4 address"
+		}
+
+	case ConstraintIPv6:
+		addr, err := netip.ParseAddr(s)
+		if err != nil || !addr.Is6() || addr.Is4In6() {
+			return "must be a valid IPv6 address"
+		}
+
+	case ConstraintSlug:
+		if !slugRegexp.MatchString(s) {
+			return "must only contain lowercase letters, numbers and dashes"
+		}
+	}
+
+	return ""
+}
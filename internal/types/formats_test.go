@@ -0,0 +1,81 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatConstraints(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		constraint  string
+		value       string
+		expectError bool
+	}{
+		{TestName: "Valid URL", constraint: "url", value: "https://hapaxredux.com/contact?x=1"},
+		{TestName: "URL without scheme", constraint: "url", value: "hapaxredux.com", expectError: true},
+		{TestName: "URL with other scheme", constraint: "url", value: "javascript:alert(1)", expectError: true},
+		{TestName: "Valid phone", constraint: "phone", value: "+5215512345678"},
+		{TestName: "Phone without plus sign", constraint: "phone", value: "5512345678", expectError: true},
+		{TestName: "Phone too long", constraint: "phone", value: "+1234567890123456", expectError: true},
+		{TestName: "Valid UUID", constraint: "uuid", value: "123e4567-e89b-12d3-a456-426614174000"},
+		{TestName: "Invalid UUID", constraint: "uuid", value: "123e4567e89b12d3a456426614174000", expectError: true},
+		{TestName: "Valid IPv4", constraint: "ipv4", value: "192.168.0.1"},
+		{TestName: "IPv6 is not IPv4", constraint: "ipv4", value: "::1", expectError: true},
+		{TestName: "Valid IPv6", constraint: "ipv6", value: "2001:db8::1"},
+		{TestName: "IPv4 is not IPv6", constraint: "ipv6", value: "192.168.0.1", expectError: true},
+		{TestName: "Valid slug", constraint: "slug", value: "contact-form-2"},
+		{TestName: "Slug with uppercase", constraint: "slug", value: "Contact-Form", expectError: true},
+		{TestName: "Slug with trailing dash", constraint: "slug", value: "contact-", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			field := FormField{Name: "field", Type: "string", Constraints: []FieldConstraint{{Name: tt.constraint}}}
+			errs := CheckFieldConstraints(field, tt.value)
+			if tt.expectError {
+				assert.Len(t, errs, 1)
+			} else {
+				assert.Empty(t, errs)
+			}
+		})
+	}
+}
+
+func TestPatternConstraint(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		pattern     string
+		value       string
+		expectError bool
+	}{
+		{TestName: "Matching postal code", pattern: `[0-9]{5}`, value: "06600"},
+		{TestName: "Pattern must match the whole value", pattern: `[0-9]{5}`, value: "066001", expectError: true},
+		{TestName: "Alternatives are anchored too", pattern: `a|b`, value: "ab", expectError: true},
+		{TestName: "Invalid pattern", pattern: `[0-9`, value: "0", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			var c FieldConstraint
+			err := json.Unmarshal([]byte(`{"constraint_name": "pattern", "pattern": `+jsonString(tt.pattern)+`}`), &c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.pattern, c.Pattern)
+
+			field := FormField{Name: "postal_code", Type: "string", Constraints: []FieldConstraint{c}}
+			errs := CheckFieldConstraints(field, tt.value)
+			if tt.expectError {
+				assert.Len(t, errs, 1)
+			} else {
+				assert.Empty(t, errs)
+			}
+		})
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
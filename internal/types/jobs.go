@@ -0,0 +1,35 @@
+package types
+
+import "encoding/json"
+
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	// JobStatusDead marks jobs that ran out of attempts. They are kept for
+	// inspection and never run again.
+	JobStatusDead = "dead"
+)
+
+// Job is a unit of background work stored in the jobs table. Payload is
+// the JSON its handler gets, e.g. a SubmissionJob.
+type Job struct {
+	ID          int             `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       string          `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   string          `json:"created_at"`
+}
+
+// SubmissionJob is the payload of the jobs enqueued with a submission.
+type SubmissionJob struct {
+	SubmissionID int `json:"submission_id"`
+}
+
+// UserJob is the payload of the jobs about a user, e.g. sending emails.
+type UserJob struct {
+	UserID int `json:"user_id"`
+}
@@ -1,7 +1,12 @@
 package types
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 )
 
@@ -47,3 +52,127 @@ func (m *JSONMap) ToJSONString() (string, error) {
 	}
 	return string(bytes), nil
 }
+
+// SubmissionValues holds every value received for each submitted field name,
+// regardless of the encoding used by the request.
+type SubmissionValues map[string][]interface{}
+
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// ErrRequestTooLarge is returned for bodies over the size limit, whether it's
+// maxMemory for JSON or an http.MaxBytesReader wrapping the body.
+var ErrRequestTooLarge = errors.New("request body too large")
+
+// First returns the first value received for name, or nil if there's none.
+func (sv SubmissionValues) First(name string) interface{} {
+	if values := sv[name]; len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// SubmissionValuesFromRequest reads the submitted fields from urlencoded,
+// multipart and JSON bodies. JSON bodies can either be a plain object mapping
+// field names to values or follow the SubmissionData shape:
+//
+//	{"fields": [{"field_name": "age", "content": 30}]}
+func SubmissionValuesFromRequest(r *http.Request, maxMemory int64) (SubmissionValues, error) {
+	mediaType := "application/x-www-form-urlencoded"
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return nil, ErrUnsupportedMediaType
+		}
+		mediaType = mt
+	}
+
+	values := make(SubmissionValues)
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, bodyError(err)
+		}
+		for key, vs := range r.PostForm {
+			for _, v := range vs {
+				values[key] = append(values[key], v)
+			}
+		}
+
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			return nil, bodyError(err)
+		}
+		for key, vs := range r.MultipartForm.Value {
+			for _, v := range vs {
+				values[key] = append(values[key], v)
+			}
+		}
+
+	case "application/json":
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxMemory+1))
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		if int64(len(body)) > maxMemory {
+			return nil, ErrRequestTooLarge
+		}
+		if err = values.readJSON(body); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, ErrUnsupportedMediaType
+	}
+
+	return values, nil
+}
+
+// bodyError turns the error of an http.MaxBytesReader into
+// ErrRequestTooLarge.
+func bodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrRequestTooLarge
+	}
+	return err
+}
+
+func (sv SubmissionValues) readJSON(body []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+
+	if fieldsRaw, ok := raw["fields"]; ok && bytes.HasPrefix(bytes.TrimSpace(fieldsRaw), []byte("[")) {
+		var data SubmissionData
+		if err := json.Unmarshal(body, &data); err != nil {
+			return fmt.Errorf("invalid submission fields: %v", err)
+		}
+		for _, field := range data.Fields {
+			sv.add(field.Name, field.Content)
+		}
+		return nil
+	}
+
+	for key, rawValue := range raw {
+		dec := json.NewDecoder(bytes.NewReader(rawValue))
+		dec.UseNumber()
+
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("invalid value for '%s': %v", key, err)
+		}
+		sv.add(key, v)
+	}
+
+	return nil
+}
+
+func (sv SubmissionValues) add(name string, value interface{}) {
+	if list, ok := value.([]interface{}); ok {
+		sv[name] = append(sv[name], list...)
+		return
+	}
+	sv[name] = append(sv[name], value)
+}
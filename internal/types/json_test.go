@@ -0,0 +1,129 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmissionValuesFromRequest(t *testing.T) {
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	mw.WriteField("name", "Penpals")
+	mw.WriteField("age", "30")
+	mw.Close()
+
+	tests := []struct {
+		TestName      string
+		contentType   string
+		body          string
+		expected      SubmissionValues
+		expectedError error
+	}{
+		{
+			TestName:    "Urlencoded",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=Penpals&age=30&tag=a&tag=b",
+			expected: SubmissionValues{
+				"name": {"Penpals"},
+				"age":  {"30"},
+				"tag":  {"a", "b"},
+			},
+		},
+		{
+			TestName:    "Multipart",
+			contentType: mw.FormDataContentType(),
+			body:        multipartBody.String(),
+			expected: SubmissionValues{
+				"name": {"Penpals"},
+				"age":  {"30"},
+			},
+		},
+		{
+			TestName:    "JSON object",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name": "Penpals", "age": 30, "subscribed": true, "tag": ["a", "b"]}`,
+			expected: SubmissionValues{
+				"name":       {"Penpals"},
+				"age":        {json.Number("30")},
+				"subscribed": {true},
+				"tag":        {"a", "b"},
+			},
+		},
+		{
+			TestName:    "JSON submission data",
+			contentType: "application/json",
+			body:        `{"fields": [{"field_name": "name", "content": "Penpals"}, {"field_name": "age", "content": 30}]}`,
+			expected: SubmissionValues{
+				"name": {"Penpals"},
+				"age":  {30},
+			},
+		},
+		{
+			TestName:      "Invalid JSON",
+			contentType:   "application/json",
+			body:          `{"name": `,
+			expectedError: nil,
+		},
+		{
+			TestName:      "Unsupported media type",
+			contentType:   "text/plain",
+			body:          "name=Penpals",
+			expectedError: ErrUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/submissions/new/1", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			values, err := SubmissionValuesFromRequest(r, 1<<20)
+			if tt.expected == nil {
+				assert.Error(t, err)
+				if tt.expectedError != nil {
+					assert.ErrorIs(t, err, tt.expectedError)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, values)
+		})
+	}
+}
+
+func TestSubmissionValuesBodyLimit(t *testing.T) {
+	var multipartBody bytes.Buffer
+	w := multipart.NewWriter(&multipartBody)
+	fw, _ := w.CreateFormFile("cv", "cv.pdf")
+	fw.Write(bytes.Repeat([]byte("x"), 4096))
+	w.Close()
+
+	tests := []struct {
+		TestName    string
+		contentType string
+		body        string
+	}{
+		{TestName: "Urlencoded", contentType: "application/x-www-form-urlencoded", body: "name=" + strings.Repeat("x", 4096)},
+		{TestName: "Multipart", contentType: w.FormDataContentType(), body: multipartBody.String()},
+		{TestName: "JSON", contentType: "application/json", body: `{"name": "` + strings.Repeat("x", 4096) + `"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/submissions/new/1", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.Body = http.MaxBytesReader(nil, r.Body, 1024)
+
+			_, err := SubmissionValuesFromRequest(r, 512)
+			assert.ErrorIs(t, err, ErrRequestTooLarge)
+		})
+	}
+}
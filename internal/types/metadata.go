@@ -0,0 +1,34 @@
+package types
+
+import "net"
+
+// SubmissionMetadata describes the request a submission came from. It's
+// stored as JSON in submissions.metadata.
+type SubmissionMetadata struct {
+	// IPAddress is the client IP, kept as the form's IPMode says.
+	IPAddress      string `json:"ip_address,omitempty"`
+	UserAgent      string `json:"user_agent,omitempty"`
+	Referer        string `json:"referer,omitempty"`
+	Origin         string `json:"origin,omitempty"`
+	AcceptLanguage string `json:"accept_language,omitempty"`
+	// UTM holds the utm_* campaign parameters found, keyed by their name.
+	UTM map[string]string `json:"utm,omitempty"`
+}
+
+// UTMParams are the campaign parameters copied into the metadata.
+var UTMParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
+
+// TruncateIP zeroes the host part of ip, keeping the /24 network of IPv4
+// addresses and the /48 of IPv6 ones. It returns an empty string if ip
+// isn't valid.
+func TruncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,27 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateIP(t *testing.T) {
+	tests := []struct {
+		TestName string
+		ip       string
+		expected string
+	}{
+		{TestName: "IPv4", ip: "203.0.113.77", expected: "203.0.113.0"},
+		{TestName: "IPv4 mapped IPv6", ip: "::ffff:203.0.113.77", expected: "203.0.113.0"},
+		{TestName: "IPv6", ip: "2001:db8:85a3:8d3:1319:8a2e:370:7348", expected: "2001:db8:85a3::"},
+		{TestName: "Invalid", ip: "not an ip", expected: ""},
+		{TestName: "Empty", ip: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			assert.Equal(t, tt.expected, TruncateIP(tt.ip))
+		})
+	}
+}
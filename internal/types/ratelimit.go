@@ -0,0 +1,40 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RateLimit is a token bucket refilled with PerMinute tokens per minute that
+// holds up to Burst tokens. A zero PerMinute disables the limit.
+type RateLimit struct {
+	PerMinute float64 `json:"per_minute"`
+	Burst     int     `json:"burst"`
+}
+
+// ParseRateLimit parses limits written as "<per minute>:<burst>", e.g.
+// "30:10". The burst defaults to 1 when it's omitted.
+func ParseRateLimit(s string) (RateLimit, error) {
+	rate, burst, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+
+	var rl RateLimit
+	var err error
+	if rl.PerMinute, err = strconv.ParseFloat(rate, 64); err != nil || rl.PerMinute < 0 || math.IsInf(rl.PerMinute, 0) || math.IsNaN(rl.PerMinute) {
+		return RateLimit{}, fmt.Errorf("invalid rate limit '%s': expected <per minute>:<burst>", s)
+	}
+
+	rl.Burst = 1
+	if hasBurst {
+		if rl.Burst, err = strconv.Atoi(burst); err != nil || rl.Burst < 1 {
+			return RateLimit{}, fmt.Errorf("invalid rate limit '%s': burst has to be a positive integer", s)
+		}
+	}
+
+	return rl, nil
+}
+
+func (rl RateLimit) String() string {
+	return fmt.Sprintf("%v:%d", rl.PerMinute, rl.Burst)
+}
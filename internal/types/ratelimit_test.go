@@ -0,0 +1,39 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		value       string
+		expected    RateLimit
+		expectError bool
+	}{
+		{TestName: "Rate and burst", value: "30:10", expected: RateLimit{PerMinute: 30, Burst: 10}},
+		{TestName: "Fractional rate", value: "0.5:1", expected: RateLimit{PerMinute: 0.5, Burst: 1}},
+		{TestName: "Default burst", value: "6", expected: RateLimit{PerMinute: 6, Burst: 1}},
+		{TestName: "Disabled", value: "0", expected: RateLimit{PerMinute: 0, Burst: 1}},
+		{TestName: "Negative rate", value: "-1:1", expectError: true},
+		{TestName: "Zero burst", value: "10:0", expectError: true},
+		{TestName: "Text", value: "fast", expectError: true},
+		{TestName: "NaN rate", value: "NaN:5", expectError: true},
+		{TestName: "Infinite rate", value: "Inf", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			rl, err := ParseRateLimit(tt.value)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, rl)
+		})
+	}
+}
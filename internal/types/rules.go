@@ -0,0 +1,248 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+)
+
+const (
+	// RuleShow makes a field part of the form only while its conditions hold.
+	// Values sent for hidden fields are rejected.
+	RuleShow = "show"
+	// RuleRequire makes a field required while its conditions hold.
+	RuleRequire = "require"
+)
+
+const (
+	RuleMatchAll = "all"
+	RuleMatchAny = "any"
+)
+
+const (
+	OpEq    = "eq"
+	OpNeq   = "neq"
+	OpIn    = "in"
+	OpNotIn = "not_in"
+	OpGt    = "gt"
+	OpGte   = "gte"
+	OpLt    = "lt"
+	OpLte   = "lte"
+)
+
+// ConstraintRule is reported for values sent for fields hidden by a rule.
+const ConstraintRule = "rule"
+
+// FieldRule is a conditional rule stored with the field it applies to. The
+// same definition is served to clients so they can show and hide fields while
+// the form is being filled.
+type FieldRule struct {
+	Effect     string          `json:"effect"`
+	Match      string          `json:"match,omitempty"`
+	Conditions []RuleCondition `json:"conditions"`
+}
+
+// RuleCondition compares the submitted value of another field against Value.
+// For "in" and "not_in" Value is a list.
+type RuleCondition struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// FieldState is the result of evaluating the rules of a field against a
+// submission.
+type FieldState struct {
+	Visible  bool
+	Required bool
+}
+
+var ruleOps = []string{OpEq, OpNeq, OpIn, OpNotIn, OpGt, OpGte, OpLt, OpLte}
+
+// EvaluateFieldRules returns the state of every field of the form given the
+// submitted values. A field whose "show" rules don't all hold is hidden, and
+// the values of hidden fields count as empty for the rules of other fields.
+// A field is required by rules when any of its "require" rules holds.
+func EvaluateFieldRules(fields []FormField, values SubmissionValues, timeLayouts []string) map[string]FieldState {
+	ev := ruleEvaluator{
+		fields:      make(map[string]FormField, len(fields)),
+		values:      values,
+		timeLayouts: timeLayouts,
+		states:      make(map[string]FieldState, len(fields)),
+		visiting:    make(map[string]bool),
+	}
+	for _, field := range fields {
+		ev.fields[field.Name] = field
+	}
+
+	for _, field := range fields {
+		ev.state(field.Name)
+	}
+
+	return ev.states
+}
+
+type ruleEvaluator struct {
+	fields      map[string]FormField
+	values      SubmissionValues
+	timeLayouts []string
+	states      map[string]FieldState
+	visiting    map[string]bool
+}
+
+func (ev *ruleEvaluator) state(name string) FieldState {
+	if state, ok := ev.states[name]; ok {
+		return state
+	}
+
+	field, ok := ev.fields[name]
+	// Cycles are rejected by ValidateFormFields; if one slips through the
+	// field is treated as hidden instead of recursing forever.
+	if !ok || ev.visiting[name] {
+		return FieldState{}
+	}
+	ev.visiting[name] = true
+	defer delete(ev.visiting, name)
+
+	state := FieldState{Visible: true}
+	for _, rule := range field.Rules {
+		holds := ev.ruleHolds(rule)
+		switch rule.Effect {
+		case RuleShow:
+			state.Visible = state.Visible && holds
+		case RuleRequire:
+			state.Required = state.Required || holds
+		}
+	}
+	if !state.Visible {
+		state.Required = false
+	}
+
+	ev.states[name] = state
+	return state
+}
+
+func (ev *ruleEvaluator) ruleHolds(rule FieldRule) bool {
+	matchAny := rule.Match == RuleMatchAny
+	for _, cond := range rule.Conditions {
+		holds := ev.conditionHolds(cond)
+		if matchAny && holds {
+			return true
+		}
+		if !matchAny && !holds {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+func (ev *ruleEvaluator) conditionHolds(cond RuleCondition) bool {
+	field, ok := ev.fields[cond.Field]
+	if !ok {
+		return false
+	}
+
+	var items []interface{}
+	if ev.state(cond.Field).Visible {
+		items = ev.fieldItems(field)
+	}
+
+	matches := func(op string) bool {
+		for _, item := range items {
+			if ok, _ := matchCondition(item, op, cond.Value, field.Type, ev.timeLayouts); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Negated operators hold when no submitted item matches, which includes
+	// fields left empty.
+	switch cond.Op {
+	case OpNeq:
+		return !matches(OpEq)
+	case OpNotIn:
+		return !matches(OpIn)
+	}
+	return matches(cond.Op)
+}
+
+// fieldItems returns the coerced non-empty values submitted for a field. Only
+// the first value is used for scalar fields, as in the submission itself.
+func (ev *ruleEvaluator) fieldItems(field FormField) []interface{} {
+	elemType, isList := ListElemType(field.Type)
+	if !isList {
+		elemType = field.Type
+	}
+
+	var items []interface{}
+	for _, v := range ev.values[field.Name] {
+		if IsEmptyValue(v) {
+			continue
+		}
+		coerced, err := CoerceValue(v, elemType, ev.timeLayouts)
+		if err != nil {
+			continue
+		}
+		items = append(items, coerced)
+		if !isList {
+			break
+		}
+	}
+	return items
+}
+
+// matchCondition applies a non-negated operator to a single coerced value.
+// The error describes why the condition's value can't be used with the field.
+func matchCondition(item interface{}, op string, condValue interface{}, fieldType string, timeLayouts []string) (bool, error) {
+	elemType, isList := ListElemType(fieldType)
+	if !isList {
+		elemType = fieldType
+	}
+
+	if op == OpIn {
+		options, ok := listItems(condValue)
+		if !ok || len(options) == 0 {
+			return false, fmt.Errorf("'%s' needs a non-empty list of values", op)
+		}
+		var firstErr error
+		for _, option := range options {
+			ok, err := matchCondition(item, OpEq, option, fieldType, timeLayouts)
+			if ok {
+				return true, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return false, firstErr
+	}
+
+	want, err := CoerceValue(condValue, elemType, timeLayouts)
+	if err != nil {
+		return false, err
+	}
+
+	if op == OpEq {
+		if cmp, ok := compareValues(item, want); ok {
+			return cmp == 0, nil
+		}
+		return reflect.DeepEqual(item, want), nil
+	}
+
+	cmp, ok := compareValues(item, want)
+	if !ok {
+		return false, fmt.Errorf("'%s' values can't be compared with '%s'", elemType, op)
+	}
+	switch op {
+	case OpGt:
+		return cmp > 0, nil
+	case OpGte:
+		return cmp >= 0, nil
+	case OpLt:
+		return cmp < 0, nil
+	case OpLte:
+		return cmp <= 0, nil
+	}
+
+	return false, fmt.Errorf("unknown operator '%s'", op)
+}
@@ -0,0 +1,108 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateFieldRules(t *testing.T) {
+	fields := []FormField{
+		{Name: "customer_type", Type: "string"},
+		{Name: "company", Type: "string", Rules: []FieldRule{
+			{Effect: "show", Conditions: []RuleCondition{{Field: "customer_type", Op: "eq", Value: "business"}}},
+			{Effect: "require", Conditions: []RuleCondition{{Field: "customer_type", Op: "eq", Value: "business"}}},
+		}},
+		{Name: "vat_id", Type: "string", Rules: []FieldRule{
+			{Effect: "require", Conditions: []RuleCondition{{Field: "customer_type", Op: "neq", Value: "personal"}}},
+		}},
+		{Name: "age", Type: "int"},
+		{Name: "guardian", Type: "string", Rules: []FieldRule{
+			{Effect: "require", Conditions: []RuleCondition{{Field: "age", Op: "lt", Value: 18}}},
+		}},
+		{Name: "topics", Type: "[]string"},
+		{Name: "details", Type: "string", Rules: []FieldRule{
+			{Effect: "show", Match: "any", Conditions: []RuleCondition{
+				{Field: "topics", Op: "in", Value: []interface{}{"support", "billing"}},
+				{Field: "age", Op: "gte", Value: 65},
+			}},
+		}},
+	}
+
+	tests := []struct {
+		TestName string
+		values   SubmissionValues
+		expected map[string]FieldState
+	}{
+		{
+			TestName: "Personal customer",
+			values:   SubmissionValues{"customer_type": {"personal"}, "age": {"30"}},
+			expected: map[string]FieldState{
+				"company":  {Visible: false},
+				"vat_id":   {Visible: true},
+				"guardian": {Visible: true},
+				"details":  {Visible: false},
+			},
+		},
+		{
+			TestName: "Business customer",
+			values:   SubmissionValues{"customer_type": {"business"}, "company": {"ACME"}},
+			expected: map[string]FieldState{
+				"company":  {Visible: true, Required: true},
+				"vat_id":   {Visible: true, Required: true},
+				"guardian": {Visible: true},
+				"details":  {Visible: false},
+			},
+		},
+		{
+			TestName: "Values of hidden fields are ignored",
+			values:   SubmissionValues{"customer_type": {"personal"}, "company": {"ACME"}},
+			expected: map[string]FieldState{
+				"company":  {Visible: false},
+				"vat_id":   {Visible: true},
+				"guardian": {Visible: true},
+				"details":  {Visible: false},
+			},
+		},
+		{
+			TestName: "Comparison on coerced values",
+			values:   SubmissionValues{"age": {"9"}},
+			expected: map[string]FieldState{
+				"company":  {Visible: false},
+				"vat_id":   {Visible: true, Required: true},
+				"guardian": {Visible: true, Required: true},
+				"details":  {Visible: false},
+			},
+		},
+		{
+			TestName: "Any item of a list matches",
+			values:   SubmissionValues{"topics": {"sales", "billing"}},
+			expected: map[string]FieldState{
+				"company":  {Visible: false},
+				"vat_id":   {Visible: true, Required: true},
+				"guardian": {Visible: true},
+				"details":  {Visible: true},
+			},
+		},
+		{
+			TestName: "Any condition matches",
+			values:   SubmissionValues{"age": {"70"}},
+			expected: map[string]FieldState{
+				"company":  {Visible: false},
+				"vat_id":   {Visible: true, Required: true},
+				"guardian": {Visible: true},
+				"details":  {Visible: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			states := EvaluateFieldRules(fields, tt.values, nil)
+			for name, expected := range tt.expected {
+				assert.Equal(t, expected, states[name], name)
+			}
+			assert.Equal(t, FieldState{Visible: true}, states["customer_type"])
+		})
+	}
+}
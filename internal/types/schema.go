@@ -0,0 +1,503 @@
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ScalarFieldTypes are the types a form field can be declared with. Each of
+// them can also be used as a list, e.g. "[]string", except for files.
+var ScalarFieldTypes = []string{"string", "int", "int64", "float64", "bool", "time.Time"}
+
+// ReservedFieldPrefix is used by the fields formy injects into forms, such as
+// render tokens, so user fields can't start with it.
+const ReservedFieldPrefix = "_formy"
+
+// RenderTokenField carries the signed token added to rendered forms.
+const RenderTokenField = ReservedFieldPrefix + "_token"
+
+// ConstraintToken is reported for submissions without a valid render token.
+const ConstraintToken = "token"
+
+// ConstraintUnexpected is reported for fields the form doesn't have when its
+// policy rejects them.
+const ConstraintUnexpected = "unexpected"
+
+const maxFieldNameLength = 64
+
+// maxNotifyEmails caps the recipients of the new submission emails.
+const maxNotifyEmails = 10
+
+func IsKnownFieldType(fieldType string) bool {
+	if fieldType == FieldTypeFile {
+		return true
+	}
+	if elemType, ok := ListElemType(fieldType); ok {
+		fieldType = elemType
+	}
+	return slices.Contains(ScalarFieldTypes, fieldType)
+}
+
+// constraintTypes lists the field types (or list element types) every
+// constraint can be declared on.
+var constraintTypes = map[string][]string{
+	ConstraintRequired: nil, // any type
+	ConstraintUnique:   {"string", "int", "int64", "float64", "bool", "time.Time"},
+	ConstraintEmail:    {"string"},
+	ConstraintURL:      {"string"},
+	ConstraintPhone:    {"string"},
+	ConstraintUUID:     {"string"},
+	ConstraintIPv4:     {"string"},
+	ConstraintIPv6:     {"string"},
+	ConstraintSlug:     {"string"},
+	ConstraintPattern:  {"string"},
+	ConstraintStrlen:   {"string"},
+	ConstraintInterval: {"string", "int", "int64", "float64", "time.Time"},
+	ConstraintChoices:  {"string", "int", "int64", "float64"},
+	ConstraintMinItems: {"[]"},
+	ConstraintMaxItems: {"[]"},
+	ConstraintMaxSize:  {FieldTypeFile},
+	ConstraintMime:     {FieldTypeFile},
+	ConstraintMaxCount: {FieldTypeFile},
+}
+
+// ValidateFormFields checks a form definition before it's stored, so broken
+// forms are rejected when they are created instead of failing on every
+// submission.
+func ValidateFormFields(fields []FormField) error {
+	var errs ValidationErrors
+	addError := func(field, constraint, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Constraint: constraint, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(fields) == 0 {
+		addError("", "", "form has to have at least one field")
+	}
+
+	seen := make(map[string]bool)
+	for i, field := range fields {
+		name := field.Name
+		switch {
+		case strings.TrimSpace(name) == "":
+			addError(fmt.Sprintf("#%d", i+1), "", "field name can't be empty")
+			continue
+		case name != strings.TrimSpace(name) || strings.IndexFunc(name, unicode.IsControl) != -1:
+			addError(name, "", "field name can't have surrounding spaces or control characters")
+		case len(name) > maxFieldNameLength:
+			addError(name, "", "field name can't be longer than %d bytes", maxFieldNameLength)
+		case strings.HasPrefix(name, ReservedFieldPrefix):
+			addError(name, "", "field names starting with '%s' are reserved", ReservedFieldPrefix)
+		}
+
+		if seen[name] {
+			addError(name, "", "duplicate field name")
+		}
+		seen[name] = true
+
+		if !IsKnownFieldType(field.Type) {
+			addError(name, ConstraintType, "unknown field type '%s'", field.Type)
+			continue
+		}
+
+		declared := make(map[string]bool)
+		for _, c := range field.Constraints {
+			if declared[c.Name] {
+				addError(name, c.Name, "constraint declared more than once")
+				continue
+			}
+			declared[c.Name] = true
+
+			if msg := validateConstraint(field, c); msg != "" {
+				addError(name, c.Name, "%s", msg)
+			}
+		}
+	}
+
+	byName := make(map[string]FormField, len(fields))
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+	for _, field := range fields {
+		for i, rule := range field.Rules {
+			if msg := validateRule(field, rule, byName); msg != "" {
+				addError(field.Name, ConstraintRule, "rule %d: %s", i+1, msg)
+			}
+		}
+	}
+	if name := findRuleCycle(fields); name != "" {
+		addError(name, ConstraintRule, "rules of this field depend on themselves")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateFormSettings checks the per form settings before they are stored.
+// fields are the fields of the form, which honeypots can't collide with.
+func ValidateFormSettings(settings FormSettings, fields []FormField) error {
+	var errs ValidationErrors
+
+	seen := make(map[string]bool)
+	for _, name := range fields {
+		seen[name.Name] = true
+	}
+	for _, name := range settings.Honeypots {
+		var msg string
+		switch {
+		case strings.TrimSpace(name) == "" || name != strings.TrimSpace(name) || strings.IndexFunc(name, unicode.IsControl) != -1:
+			msg = fmt.Sprintf("invalid honeypot name '%s'", name)
+		case len(name) > maxFieldNameLength:
+			msg = fmt.Sprintf("honeypot name can't be longer than %d bytes", maxFieldNameLength)
+		case strings.HasPrefix(name, ReservedFieldPrefix):
+			msg = fmt.Sprintf("honeypot names starting with '%s' are reserved", ReservedFieldPrefix)
+		case seen[name]:
+			msg = fmt.Sprintf("honeypot '%s' is repeated or has the name of a field", name)
+		}
+		seen[name] = true
+
+		if msg != "" {
+			errs = append(errs, FieldError{Field: "honeypots", Message: msg})
+		}
+	}
+
+	switch settings.TokenPolicy {
+	case "", TokenPolicyFlag, TokenPolicyReject:
+	default:
+		errs = append(errs, FieldError{Field: "token_policy", Message: fmt.Sprintf("unknown token policy '%s'", settings.TokenPolicy)})
+	}
+	if settings.MinFillSeconds < 0 || settings.MaxTokenAgeSeconds < 0 {
+		errs = append(errs, FieldError{Field: "token_policy", Message: "fill times can't be negative"})
+	} else if settings.MaxTokenAgeSeconds > 0 && settings.MinFillSeconds >= settings.MaxTokenAgeSeconds {
+		errs = append(errs, FieldError{Field: "token_policy", Message: "minimum fill time has to be shorter than the maximum token age"})
+	}
+
+	switch settings.IPMode {
+	case "", IPModeRaw, IPModeTruncated, IPModeHashed:
+	default:
+		errs = append(errs, FieldError{Field: "ip_mode", Message: fmt.Sprintf("unknown ip mode '%s'", settings.IPMode)})
+	}
+
+	switch settings.UnexpectedFields {
+	case "", UnexpectedFieldsIgnore, UnexpectedFieldsStore, UnexpectedFieldsReject:
+	default:
+		errs = append(errs, FieldError{Field: "unexpected_fields", Message: fmt.Sprintf("unknown unexpected fields policy '%s'", settings.UnexpectedFields)})
+	}
+
+	if settings.Notify && len(settings.NotifyEmails) == 0 {
+		errs = append(errs, FieldError{Field: "notify_emails", Message: "notifications need at least one recipient"})
+	}
+	if len(settings.NotifyEmails) > maxNotifyEmails {
+		errs = append(errs, FieldError{Field: "notify_emails", Message: fmt.Sprintf("notifications can have up to %d recipients", maxNotifyEmails)})
+	}
+	for _, addr := range settings.NotifyEmails {
+		if msg := checkFormat(ConstraintEmail, addr); msg != "" {
+			errs = append(errs, FieldError{Field: "notify_emails", Message: fmt.Sprintf("'%s' %s", addr, msg)})
+		}
+	}
+
+	limits := []struct {
+		name  string
+		limit *RateLimit
+	}{
+		{"rate_limits.per_form", settings.RateLimits.PerForm},
+		{"rate_limits.per_ip_form", settings.RateLimits.PerIPForm},
+	}
+	for _, l := range limits {
+		if rl := l.limit; rl != nil && (rl.PerMinute < 0 || (rl.PerMinute > 0 && rl.Burst < 1)) {
+			errs = append(errs, FieldError{Field: l.name, Message: "rate can't be negative and burst has to be at least 1"})
+		}
+	}
+
+	if redirect := settings.SuccessRedirect; redirect != "" && !isSafeRedirect(redirect) {
+		errs = append(errs, FieldError{
+			Field:   "success_redirect",
+			Message: "redirect has to be an absolute http(s) URL or a path starting with '/'",
+		})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func isSafeRedirect(redirect string) bool {
+	u, err := url.Parse(redirect)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return strings.HasPrefix(redirect, "/") && !strings.HasPrefix(redirect, "//") && !strings.Contains(redirect, "\\")
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validateConstraint(field FormField, c FieldConstraint) string {
+	allowedTypes, known := constraintTypes[c.Name]
+	if !known {
+		return fmt.Sprintf("unknown constraint '%s'", c.Name)
+	}
+
+	elemType, isList := ListElemType(field.Type)
+	if !isList {
+		elemType = field.Type
+	}
+
+	if allowedTypes != nil {
+		compatible := false
+		for _, t := range allowedTypes {
+			if t == elemType || (t == "[]" && isList) {
+				compatible = true
+			}
+		}
+		if !compatible {
+			return fmt.Sprintf("constraint can't be used on '%s' fields", field.Type)
+		}
+	}
+
+	switch c.Name {
+	case ConstraintInterval:
+		return validateInterval(c, elemType)
+
+	case ConstraintStrlen, ConstraintMinItems, ConstraintMaxItems, ConstraintMaxSize, ConstraintMaxCount:
+		return validateCountBounds(c)
+
+	case ConstraintPattern:
+		if _, err := CompilePattern(c.Pattern); err != nil {
+			return fmt.Sprintf("invalid pattern: %v", err)
+		}
+
+	case ConstraintChoices:
+		return validateChoices(c, elemType)
+
+	case ConstraintMime:
+		if len(c.Values) == 0 {
+			return "at least one mime type is required"
+		}
+		for _, v := range c.Values {
+			if parts := strings.Split(v, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Sprintf("invalid mime type '%s'", v)
+			}
+		}
+	}
+
+	return ""
+}
+
+func validateInterval(c FieldConstraint, elemType string) string {
+	if c.Min == nil && c.Max == nil {
+		return "interval needs a min or a max"
+	}
+
+	var sample interface{}
+	switch elemType {
+	case "int", "int64", "float64":
+		sample = 0.0
+	case "time.Time":
+		sample = time.Time{}
+	default:
+		sample = ""
+	}
+
+	for _, bound := range []interface{}{c.Min, c.Max} {
+		if bound == nil {
+			continue
+		}
+		if _, ok := compareValues(sample, bound); !ok {
+			return fmt.Sprintf("bound %v can't be compared with '%s' values", bound, elemType)
+		}
+	}
+
+	if c.Min != nil && c.Max != nil {
+		if cmp, ok := compareValues(normalizeBound(c.Min), c.Max); ok && cmp > 0 {
+			return fmt.Sprintf("min %v is greater than max %v", c.Min, c.Max)
+		}
+	}
+
+	return ""
+}
+
+// normalizeBound turns date strings into time.Time so they can be used as the
+// left side of compareValues.
+func normalizeBound(bound interface{}) interface{} {
+	if s, ok := bound.(string); ok {
+		if t, ok := ParseTime(s, nil); ok {
+			return t
+		}
+	}
+	return bound
+}
+
+func validateCountBounds(c FieldConstraint) string {
+	var min, max float64
+	var hasMin, hasMax bool
+
+	if c.Min != nil {
+		if min, hasMin = toFloat(c.Min); !hasMin || min < 0 || min != float64(int64(min)) {
+			return fmt.Sprintf("min has to be a non-negative integer, got %v", c.Min)
+		}
+	}
+	if c.Max != nil {
+		if max, hasMax = toFloat(c.Max); !hasMax || max < 0 || max != float64(int64(max)) {
+			return fmt.Sprintf("max has to be a non-negative integer, got %v", c.Max)
+		}
+	}
+
+	switch c.Name {
+	case ConstraintMinItems:
+		if !hasMin {
+			return "min is required"
+		}
+	case ConstraintMaxItems, ConstraintMaxSize, ConstraintMaxCount:
+		if !hasMax {
+			return "max is required"
+		}
+	default:
+		if !hasMin && !hasMax {
+			return "min or max is required"
+		}
+	}
+
+	if hasMin && hasMax && min > max {
+		return fmt.Sprintf("min %v is greater than max %v", c.Min, c.Max)
+	}
+
+	return ""
+}
+
+func validateChoices(c FieldConstraint, elemType string) string {
+	if len(c.Choices) == 0 {
+		return "at least one choice is required"
+	}
+
+	seen := make(map[string]bool)
+	for _, choice := range c.Choices {
+		if seen[choice.Value] {
+			return fmt.Sprintf("duplicate choice '%s'", choice.Value)
+		}
+		seen[choice.Value] = true
+
+		if _, err := CoerceValue(choice.Value, elemType, nil); err != nil {
+			return fmt.Sprintf("choice '%s' isn't a valid '%s'", choice.Value, elemType)
+		}
+	}
+
+	return ""
+}
+
+func validateRule(field FormField, rule FieldRule, byName map[string]FormField) string {
+	if rule.Effect != RuleShow && rule.Effect != RuleRequire {
+		return fmt.Sprintf("unknown effect '%s'", rule.Effect)
+	}
+	if rule.Match != "" && rule.Match != RuleMatchAll && rule.Match != RuleMatchAny {
+		return fmt.Sprintf("unknown match '%s'", rule.Match)
+	}
+	if len(rule.Conditions) == 0 {
+		return "at least one condition is required"
+	}
+
+	for _, cond := range rule.Conditions {
+		other, ok := byName[cond.Field]
+		switch {
+		case !ok:
+			return fmt.Sprintf("unknown field '%s'", cond.Field)
+		case cond.Field == field.Name:
+			return "a field can't depend on itself"
+		case other.Type == FieldTypeFile:
+			return fmt.Sprintf("file field '%s' can't be used in conditions", cond.Field)
+		case !slices.Contains(ruleOps, cond.Op):
+			return fmt.Sprintf("unknown operator '%s'", cond.Op)
+		}
+
+		if msg := validateConditionValue(cond, other.Type); msg != "" {
+			return fmt.Sprintf("field '%s': %s", cond.Field, msg)
+		}
+	}
+
+	return ""
+}
+
+func validateConditionValue(cond RuleCondition, fieldType string) string {
+	elemType, isList := ListElemType(fieldType)
+	if !isList {
+		elemType = fieldType
+	}
+
+	values := []interface{}{cond.Value}
+	if cond.Op == OpIn || cond.Op == OpNotIn {
+		items, ok := listItems(cond.Value)
+		if !ok || len(items) == 0 {
+			return fmt.Sprintf("'%s' needs a non-empty list of values", cond.Op)
+		}
+		values = items
+	}
+
+	for _, v := range values {
+		want, err := CoerceValue(v, elemType, nil)
+		if err != nil {
+			return fmt.Sprintf("invalid value: %v", err)
+		}
+
+		switch cond.Op {
+		case OpGt, OpGte, OpLt, OpLte:
+			if _, ok := compareValues(want, want); !ok {
+				return fmt.Sprintf("'%s' values can't be compared with '%s'", elemType, cond.Op)
+			}
+		}
+	}
+
+	return ""
+}
+
+// findRuleCycle returns the name of a field whose rules end up depending on
+// the field itself, or an empty string if there are no cycles.
+func findRuleCycle(fields []FormField) string {
+	deps := make(map[string][]string, len(fields))
+	for _, field := range fields {
+		for _, rule := range field.Rules {
+			for _, cond := range rule.Conditions {
+				if cond.Field != field.Name {
+					deps[field.Name] = append(deps[field.Name], cond.Field)
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	marks := make(map[string]int, len(fields))
+
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		switch marks[name] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		marks[name] = visiting
+		for _, dep := range deps[name] {
+			if visit(dep) {
+				return true
+			}
+		}
+		marks[name] = done
+		return false
+	}
+
+	for _, field := range fields {
+		if visit(field.Name) {
+			return field.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,329 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFormFields(t *testing.T) {
+	tests := []struct {
+		TestName       string
+		fields         []FormField
+		expectedErrors []FieldError
+	}{
+		{
+			TestName: "Valid contact form",
+			fields: []FormField{
+				{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "required"}, {Name: "strlen", Min: 1, Max: 128}}},
+				{Name: "email", Type: "string", Constraints: []FieldConstraint{{Name: "email"}, {Name: "unique"}}},
+				{Name: "age", Type: "int", Constraints: []FieldConstraint{{Name: "interval", Min: 0, Max: 150}}},
+				{Name: "since", Type: "time.Time", Constraints: []FieldConstraint{{Name: "interval", Min: "2022-01-01", Max: "2025-01-01T00:00:00Z"}}},
+				{Name: "tags", Type: "[]string", Constraints: []FieldConstraint{{Name: "max_items", Max: 3}, {Name: "choices", Choices: []ChoiceOption{{Value: "a"}, {Value: "b"}}}}},
+				{Name: "cv", Type: "file", Constraints: []FieldConstraint{{Name: "mime", Values: []string{"application/pdf"}}, {Name: "max_size", Max: 1 << 20}}},
+			},
+			expectedErrors: nil,
+		},
+		{
+			TestName:       "No fields",
+			fields:         nil,
+			expectedErrors: []FieldError{{Field: "", Constraint: ""}},
+		},
+		{
+			TestName: "Unknown type",
+			fields: []FormField{
+				{Name: "age", Type: "integer"},
+				{Name: "files", Type: "[]file"},
+			},
+			expectedErrors: []FieldError{{Field: "age", Constraint: "type"}, {Field: "files", Constraint: "type"}},
+		},
+		{
+			TestName: "Empty and duplicate names",
+			fields: []FormField{
+				{Name: "email", Type: "string"},
+				{Name: " ", Type: "string"},
+				{Name: "email", Type: "string"},
+			},
+			expectedErrors: []FieldError{{Field: "#2", Constraint: ""}, {Field: "email", Constraint: ""}},
+		},
+		{
+			TestName: "Reserved name",
+			fields: []FormField{
+				{Name: "_formy_token", Type: "string"},
+			},
+			expectedErrors: []FieldError{{Field: "_formy_token", Constraint: ""}},
+		},
+		{
+			TestName: "Unknown constraint",
+			fields: []FormField{
+				{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "mandatory"}}},
+			},
+			expectedErrors: []FieldError{{Field: "name", Constraint: "mandatory"}},
+		},
+		{
+			TestName: "Constraint not compatible with type",
+			fields: []FormField{
+				{Name: "age", Type: "int", Constraints: []FieldConstraint{{Name: "strlen", Max: 3}}},
+				{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "max_items", Max: 3}}},
+				{Name: "cv", Type: "file", Constraints: []FieldConstraint{{Name: "unique"}}},
+			},
+			expectedErrors: []FieldError{{Field: "age", Constraint: "strlen"}, {Field: "name", Constraint: "max_items"}, {Field: "cv", Constraint: "unique"}},
+		},
+		{
+			TestName: "Inverted bounds",
+			fields: []FormField{
+				{Name: "age", Type: "int", Constraints: []FieldConstraint{{Name: "interval", Min: 150, Max: 0}}},
+				{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "strlen", Min: 10, Max: 1}}},
+				{Name: "since", Type: "time.Time", Constraints: []FieldConstraint{{Name: "interval", Min: "2025-01-01", Max: "2022-01-01"}}},
+			},
+			expectedErrors: []FieldError{{Field: "age", Constraint: "interval"}, {Field: "name", Constraint: "strlen"}, {Field: "since", Constraint: "interval"}},
+		},
+		{
+			TestName: "Bounds of the wrong type",
+			fields: []FormField{
+				{Name: "age", Type: "int", Constraints: []FieldConstraint{{Name: "interval", Min: "a"}}},
+				{Name: "since", Type: "time.Time", Constraints: []FieldConstraint{{Name: "interval", Max: 10}}},
+				{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "strlen", Max: -1}}},
+				{Name: "bio", Type: "string", Constraints: []FieldConstraint{{Name: "strlen"}}},
+			},
+			expectedErrors: []FieldError{{Field: "age", Constraint: "interval"}, {Field: "since", Constraint: "interval"}, {Field: "name", Constraint: "strlen"}, {Field: "bio", Constraint: "strlen"}},
+		},
+		{
+			TestName: "Invalid constraint parameters",
+			fields: []FormField{
+				{Name: "cp", Type: "string", Constraints: []FieldConstraint{{Name: "pattern", Pattern: "[0-9"}}},
+				{Name: "size", Type: "int", Constraints: []FieldConstraint{{Name: "choices", Choices: []ChoiceOption{{Value: "small"}}}}},
+				{Name: "cv", Type: "file", Constraints: []FieldConstraint{{Name: "mime", Values: []string{"pdf"}}}},
+				{Name: "tags", Type: "[]string", Constraints: []FieldConstraint{{Name: "choices", Choices: []ChoiceOption{{Value: "a"}, {Value: "a"}}}}},
+			},
+			expectedErrors: []FieldError{{Field: "cp", Constraint: "pattern"}, {Field: "size", Constraint: "choices"}, {Field: "cv", Constraint: "mime"}, {Field: "tags", Constraint: "choices"}},
+		},
+		{
+			TestName: "Repeated constraint",
+			fields: []FormField{
+				{Name: "name", Type: "string", Constraints: []FieldConstraint{{Name: "required"}, {Name: "required"}}},
+			},
+			expectedErrors: []FieldError{{Field: "name", Constraint: "required"}},
+		},
+		{
+			TestName: "Valid rules",
+			fields: []FormField{
+				{Name: "customer_type", Type: "string"},
+				{Name: "age", Type: "int"},
+				{Name: "company", Type: "string", Rules: []FieldRule{
+					{Effect: "require", Conditions: []RuleCondition{{Field: "customer_type", Op: "in", Value: []interface{}{"business", "ngo"}}}},
+					{Effect: "show", Match: "any", Conditions: []RuleCondition{{Field: "age", Op: "gte", Value: 18}, {Field: "customer_type", Op: "neq", Value: "personal"}}},
+				}},
+			},
+			expectedErrors: nil,
+		},
+		{
+			TestName: "Invalid rules",
+			fields: []FormField{
+				{Name: "age", Type: "int"},
+				{Name: "newsletter", Type: "bool"},
+				{Name: "cv", Type: "file"},
+				{Name: "a", Type: "string", Rules: []FieldRule{{Effect: "hide", Conditions: []RuleCondition{{Field: "age", Op: "eq", Value: 1}}}}},
+				{Name: "b", Type: "string", Rules: []FieldRule{{Effect: "show"}}},
+				{Name: "c", Type: "string", Rules: []FieldRule{{Effect: "show", Conditions: []RuleCondition{{Field: "missing", Op: "eq", Value: 1}}}}},
+				{Name: "d", Type: "string", Rules: []FieldRule{{Effect: "show", Conditions: []RuleCondition{{Field: "age", Op: "like", Value: 1}}}}},
+				{Name: "e", Type: "string", Rules: []FieldRule{{Effect: "show", Conditions: []RuleCondition{{Field: "age", Op: "eq", Value: "old"}}}}},
+				{Name: "f", Type: "string", Rules: []FieldRule{{Effect: "show", Conditions: []RuleCondition{{Field: "age", Op: "in", Value: 3}}}}},
+				{Name: "g", Type: "string", Rules: []FieldRule{{Effect: "show", Conditions: []RuleCondition{{Field: "newsletter", Op: "gt", Value: true}}}}},
+				{Name: "h", Type: "string", Rules: []FieldRule{{Effect: "show", Conditions: []RuleCondition{{Field: "cv", Op: "eq", Value: "x"}}}}},
+				{Name: "i", Type: "string", Rules: []FieldRule{{Effect: "show", Conditions: []RuleCondition{{Field: "i", Op: "eq", Value: "x"}}}}},
+			},
+			expectedErrors: []FieldError{
+				{Field: "a", Constraint: "rule"}, {Field: "b", Constraint: "rule"}, {Field: "c", Constraint: "rule"},
+				{Field: "d", Constraint: "rule"}, {Field: "e", Constraint: "rule"}, {Field: "f", Constraint: "rule"},
+				{Field: "g", Constraint: "rule"}, {Field: "h", Constraint: "rule"}, {Field: "i", Constraint: "rule"},
+			},
+		},
+		{
+			TestName: "Rule cycle",
+			fields: []FormField{
+				{Name: "a", Type: "string", Rules: []FieldRule{{Effect: "show", Conditions: []RuleCondition{{Field: "b", Op: "eq", Value: "x"}}}}},
+				{Name: "b", Type: "string", Rules: []FieldRule{{Effect: "require", Conditions: []RuleCondition{{Field: "a", Op: "eq", Value: "x"}}}}},
+			},
+			expectedErrors: []FieldError{{Field: "a", Constraint: "rule"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := ValidateFormFields(tt.fields)
+			if tt.expectedErrors == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var got []FieldError
+			for _, fe := range err.(ValidationErrors) {
+				assert.NotEmpty(t, fe.Message)
+				got = append(got, FieldError{Field: fe.Field, Constraint: fe.Constraint})
+			}
+			assert.Equal(t, tt.expectedErrors, got)
+		})
+	}
+}
+
+func TestValidateFormSettings(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		redirect    string
+		expectError bool
+	}{
+		{TestName: "No redirect", redirect: ""},
+		{TestName: "Absolute URL", redirect: "https://hapaxredux.com/gracias"},
+		{TestName: "Local path", redirect: "/gracias?from=form"},
+		{TestName: "Relative path", redirect: "gracias", expectError: true},
+		{TestName: "Protocol relative URL", redirect: "//evil.com", expectError: true},
+		{TestName: "Backslash path", redirect: "/\\evil.com", expectError: true},
+		{TestName: "Javascript URL", redirect: "javascript:alert(1)", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := ValidateFormSettings(FormSettings{SuccessRedirect: tt.redirect}, nil)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateHoneypots(t *testing.T) {
+	fields := []FormField{{Name: "email", Type: "string"}}
+
+	tests := []struct {
+		TestName    string
+		honeypots   []string
+		expectError bool
+	}{
+		{TestName: "No honeypots"},
+		{TestName: "Valid honeypots", honeypots: []string{"website", "fax"}},
+		{TestName: "Empty name", honeypots: []string{""}, expectError: true},
+		{TestName: "Name of a field", honeypots: []string{"email"}, expectError: true},
+		{TestName: "Repeated honeypot", honeypots: []string{"website", "website"}, expectError: true},
+		{TestName: "Render token name", honeypots: []string{RenderTokenField}, expectError: true},
+		{TestName: "Reserved prefix", honeypots: []string{ReservedFieldPrefix + "trap"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := ValidateFormSettings(FormSettings{Honeypots: tt.honeypots}, fields)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateTokenSettings(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		settings    FormSettings
+		expectError bool
+	}{
+		{TestName: "Tokens disabled", settings: FormSettings{}},
+		{TestName: "Flag with fill times", settings: FormSettings{TokenPolicy: "flag", MinFillSeconds: 3, MaxTokenAgeSeconds: 3600}},
+		{TestName: "Reject with default max age", settings: FormSettings{TokenPolicy: "reject", MinFillSeconds: 5}},
+		{TestName: "Unknown policy", settings: FormSettings{TokenPolicy: "block"}, expectError: true},
+		{TestName: "Negative fill time", settings: FormSettings{TokenPolicy: "flag", MinFillSeconds: -1}, expectError: true},
+		{TestName: "Min longer than max", settings: FormSettings{TokenPolicy: "flag", MinFillSeconds: 60, MaxTokenAgeSeconds: 30}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := ValidateFormSettings(tt.settings, nil)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateIPMode(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		mode        string
+		expectError bool
+	}{
+		{TestName: "Default", mode: ""},
+		{TestName: "Raw", mode: "raw"},
+		{TestName: "Truncated", mode: "truncated"},
+		{TestName: "Hashed", mode: "hashed"},
+		{TestName: "Unknown", mode: "masked", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := ValidateFormSettings(FormSettings{IPMode: tt.mode}, nil)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateUnexpectedFieldsPolicy(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		policy      string
+		expectError bool
+	}{
+		{TestName: "Default", policy: ""},
+		{TestName: "Ignore", policy: "ignore"},
+		{TestName: "Store", policy: "store"},
+		{TestName: "Reject", policy: "reject"},
+		{TestName: "Unknown", policy: "drop", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := ValidateFormSettings(FormSettings{UnexpectedFields: tt.policy}, nil)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateNotifySettings(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		settings    FormSettings
+		expectError bool
+	}{
+		{TestName: "Disabled", settings: FormSettings{}},
+		{TestName: "Enabled", settings: FormSettings{Notify: true, NotifyEmails: []string{"sales@example.com", "ops@example.com"}}},
+		{TestName: "Recipients kept while disabled", settings: FormSettings{NotifyEmails: []string{"sales@example.com"}}},
+		{TestName: "No recipients", settings: FormSettings{Notify: true}, expectError: true},
+		{TestName: "Invalid recipient", settings: FormSettings{Notify: true, NotifyEmails: []string{"Sales <sales@example.com>"}}, expectError: true},
+		{TestName: "Too many recipients", settings: FormSettings{Notify: true, NotifyEmails: []string{
+			"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com", "f@example.com",
+			"g@example.com", "h@example.com", "i@example.com", "j@example.com", "k@example.com",
+		}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := ValidateFormSettings(tt.settings, nil)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package types
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	MinPasswordLength = 10
+	// MaxPasswordLength is in bytes, bcrypt ignores anything past it.
+	MaxPasswordLength = 72
+)
+
+var userNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+// commonPasswords are rejected even if they pass the other rules.
+var commonPasswords = map[string]bool{
+	"123456789a":   true,
+	"contraseña1":  true,
+	"password123":  true,
+	"password1234": true,
+	"qwerty12345":  true,
+	"qwertyuiop1":  true,
+}
+
+// Registration is what the sign up form sends.
+type Registration struct {
+	UserName             string
+	Email                string
+	Password             string
+	PasswordConfirmation string
+}
+
+// Validate checks every field of the registration. Whether the user name or
+// email are taken is left to the database.
+func (r Registration) Validate() ValidationErrors {
+	var errs ValidationErrors
+	add := func(field, constraint, msg string) {
+		errs = append(errs, FieldError{Field: field, Constraint: constraint, Message: msg})
+	}
+
+	if !userNameRegexp.MatchString(r.UserName) {
+		add("user_name", ConstraintType, "user name must be 3 to 32 letters, digits, '_', '.' or '-'")
+	}
+
+	if r.Email == "" {
+		add("email", ConstraintRequired, "field is required")
+	} else if !IsEmail(r.Email) {
+		add("email", ConstraintEmail, "must be a valid email address")
+	}
+
+	if msg := CheckPassword(r.Password, r.UserName); msg != "" {
+		add("password", "password", msg)
+	} else if r.Password != r.PasswordConfirmation {
+		add("password_confirmation", "password", "passwords don't match")
+	}
+
+	return errs
+}
+
+// IsEmail reports whether s is a bare email address, e.g. "ana@example.com".
+func IsEmail(s string) bool {
+	return checkFormat(ConstraintEmail, s) == ""
+}
+
+// CheckPassword returns why password is too weak for userName, or "" if it's
+// good enough.
+func CheckPassword(password, userName string) string {
+	if len([]rune(password)) < MinPasswordLength {
+		return "password must have at least 10 characters"
+	}
+	if len(password) > MaxPasswordLength {
+		return "password can't be longer than 72 bytes"
+	}
+
+	var letter, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	if !letter || !digit {
+		return "password must have letters and digits"
+	}
+
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return "password is too common"
+	}
+	if userName != "" && strings.Contains(lower, strings.ToLower(userName)) {
+		return "password can't contain the user name"
+	}
+
+	return ""
+}
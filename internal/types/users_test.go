@@ -0,0 +1,77 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		userName string
+		valid    bool
+	}{
+		{name: "Good password", password: "tortuga-azul-42", userName: "ana", valid: true},
+		{name: "Too short", password: "abc123", valid: false},
+		{name: "Too long", password: "a1" + string(make([]byte, 71)), valid: false},
+		{name: "Only letters", password: "correcthorse", valid: false},
+		{name: "Only digits", password: "12345678901", valid: false},
+		{name: "Common", password: "Password123", valid: false},
+		{name: "Contains the user name", password: "ana.lopez2024", userName: "Lopez", valid: false},
+		{name: "Unicode letters count", password: "contraseñá9x", valid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CheckPassword(tt.password, tt.userName)
+			if tt.valid {
+				assert.Empty(t, msg)
+			} else {
+				assert.NotEmpty(t, msg)
+			}
+		})
+	}
+}
+
+func TestRegistrationValidate(t *testing.T) {
+	valid := Registration{
+		UserName:             "ana_lopez",
+		Email:                "ana@example.com",
+		Password:             "tortuga-azul-42",
+		PasswordConfirmation: "tortuga-azul-42",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *Registration)
+		fields []string
+	}{
+		{name: "Valid", modify: func(r *Registration) {}},
+		{name: "Short user name", modify: func(r *Registration) { r.UserName = "an" }, fields: []string{"user_name"}},
+		{name: "User name with spaces", modify: func(r *Registration) { r.UserName = "ana lopez" }, fields: []string{"user_name"}},
+		{name: "Missing email", modify: func(r *Registration) { r.Email = "" }, fields: []string{"email"}},
+		{name: "Invalid email", modify: func(r *Registration) { r.Email = "Ana <ana@example.com>" }, fields: []string{"email"}},
+		{name: "Weak password", modify: func(r *Registration) { r.Password, r.PasswordConfirmation = "short1", "short1" }, fields: []string{"password"}},
+		{name: "Passwords don't match", modify: func(r *Registration) { r.PasswordConfirmation = "tortuga-azul-43" }, fields: []string{"password_confirmation"}},
+		{
+			name:   "Everything wrong",
+			modify: func(r *Registration) { *r = Registration{UserName: "?", Email: "nope", Password: "x"} },
+			fields: []string{"user_name", "email", "password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid
+			tt.modify(&r)
+
+			var fields []string
+			for _, fe := range r.Validate() {
+				fields = append(fields, fe.Field)
+			}
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+const (
+	WebhookEventSubmissionCreated = "submission.created"
+	// WebhookEventTest is sent on demand so owners can check their endpoint.
+	WebhookEventTest = "test"
+)
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// Webhook is an endpoint new submissions of a form are posted to. Secret
+// signs every delivery so the receiver can tell they come from formy.
+type Webhook struct {
+	ID        int    `json:"id"`
+	FormID    int    `json:"form_id"`
+	FormName  string `json:"form_name,omitempty"`
+	URL       string `json:"url"`
+	Secret    string `json:"secret"`
+	CreatedAt string `json:"created_at"`
+}
+
+// WebhookDelivery is an event sent, or to be sent, to a webhook. Status,
+// StatusCode and ResponseExcerpt are those of the last attempt.
+type WebhookDelivery struct {
+	ID              int             `json:"id"`
+	WebhookID       int             `json:"webhook_id"`
+	SubmissionID    int             `json:"submission_id,omitempty"`
+	Event           string          `json:"event"`
+	Payload         json.RawMessage `json:"payload"`
+	Status          string          `json:"status"`
+	Attempts        int             `json:"attempts"`
+	StatusCode      int             `json:"status_code,omitempty"`
+	ResponseExcerpt string          `json:"response_excerpt,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	CreatedAt       string          `json:"created_at"`
+	DeliveredAt     string          `json:"delivered_at,omitempty"`
+}
+
+// WebhookPayload is the body of a delivery.
+type WebhookPayload struct {
+	Event      string          `json:"event"`
+	Form       WebhookForm     `json:"form"`
+	Submission *SubmissionData `json:"submission,omitempty"`
+}
+
+type WebhookForm struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	FormVersion int    `json:"form_version"`
+}
+
+// WebhookDeliveryJob is the payload of the jobs that send a delivery.
+type WebhookDeliveryJob struct {
+	DeliveryID int `json:"delivery_id"`
+}
+
+// ErrPrivateWebhookAddress is returned for webhooks pointing to the server
+// itself or to its private network.
+var ErrPrivateWebhookAddress = errors.New("webhook URL can't point to a loopback, private or link-local address")
+
+// ValidateWebhookURL checks that rawURL is an absolute http(s) URL that
+// doesn't name a private host. Host names are only resolved when delivering,
+// where CheckWebhookAddr is applied to every address dialed.
+func ValidateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook URL has to be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return errors.New("webhook URL can't include credentials")
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateWebhookAddress
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return CheckWebhookAddr(addr)
+	}
+	return nil
+}
+
+// CheckWebhookAddr refuses the addresses webhooks mustn't be delivered to.
+func CheckWebhookAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsMulticast() {
+		return ErrPrivateWebhookAddress
+	}
+	return nil
+}
@@ -40,6 +40,9 @@ func NewTestDB() (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Every connection to :memory: gets its own empty database, so the pool
+	// can't open a second one, e.g. for the job workers.
+	db.SetMaxOpenConns(1)
 
 	if err = MigrateDB(db); err != nil {
 		return nil, err
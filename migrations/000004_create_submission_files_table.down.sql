@@ -0,0 +1,3 @@
+-- Down migration
+
+DROP TABLE IF EXISTS submission_files;
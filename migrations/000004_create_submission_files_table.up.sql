@@ -0,0 +1,16 @@
+-- Up migration
+
+CREATE TABLE submission_files (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    submission_id INTEGER NOT NULL,
+    field_name TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    blob_hash TEXT NOT NULL,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (submission_id) REFERENCES submissions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_submission_files_submission_id ON submission_files(submission_id);
+CREATE INDEX idx_submission_files_blob_hash ON submission_files(blob_hash);
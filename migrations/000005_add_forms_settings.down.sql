@@ -0,0 +1,3 @@
+-- Down migration
+
+ALTER TABLE forms DROP COLUMN settings;
@@ -0,0 +1,3 @@
+-- Up migration
+
+ALTER TABLE forms ADD COLUMN settings TEXT NOT NULL DEFAULT '{}' CHECK (json_valid(settings));
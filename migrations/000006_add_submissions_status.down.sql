@@ -0,0 +1,5 @@
+-- Down migration
+
+DROP INDEX IF EXISTS idx_submissions_form_id_status;
+
+ALTER TABLE submissions DROP COLUMN status;
@@ -0,0 +1,5 @@
+-- Up migration
+
+ALTER TABLE submissions ADD COLUMN status TEXT NOT NULL DEFAULT 'accepted' CHECK (status IN ('accepted', 'spam'));
+
+CREATE INDEX idx_submissions_form_id_status ON submissions(form_id, status);
@@ -0,0 +1,3 @@
+-- Down migration
+
+DROP TABLE IF EXISTS used_form_tokens;
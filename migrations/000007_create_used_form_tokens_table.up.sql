@@ -0,0 +1,11 @@
+-- Up migration
+
+CREATE TABLE used_form_tokens (
+    nonce TEXT PRIMARY KEY,
+    form_id INTEGER NOT NULL,
+    expires_at TEXT NOT NULL,
+    used_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (form_id) REFERENCES forms(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_used_form_tokens_expires_at ON used_form_tokens(expires_at);
@@ -0,0 +1,7 @@
+-- Down migration
+
+DROP INDEX IF EXISTS idx_incidents_form_id;
+
+DROP TABLE IF EXISTS incidents;
+
+DROP TABLE IF EXISTS submission_unexpected_fields;
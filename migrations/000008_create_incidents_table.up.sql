@@ -0,0 +1,24 @@
+-- Up migration
+
+CREATE TABLE submission_unexpected_fields (
+    field_name TEXT NOT NULL,
+    submission_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    PRIMARY KEY (field_name, submission_id),
+    FOREIGN KEY (submission_id) REFERENCES submissions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE incidents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    form_id INTEGER NOT NULL,
+    -- NULL when the submission was rejected or later deleted.
+    submission_id INTEGER,
+    kind TEXT NOT NULL CHECK (kind IN ('unexpected_fields')),
+    policy TEXT NOT NULL CHECK (policy IN ('store', 'reject')),
+    details TEXT NOT NULL CHECK (json_valid(details)),
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (form_id) REFERENCES forms(id) ON DELETE CASCADE,
+    FOREIGN KEY (submission_id) REFERENCES submissions(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_incidents_form_id ON incidents(form_id);
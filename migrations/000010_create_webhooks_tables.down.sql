@@ -0,0 +1,9 @@
+-- Down migration
+
+DROP INDEX IF EXISTS idx_webhook_deliveries_webhook_id;
+
+DROP TABLE IF EXISTS webhook_deliveries;
+
+DROP INDEX IF EXISTS idx_webhooks_form_id;
+
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,5 @@
+-- Down migration
+
+DROP INDEX IF EXISTS idx_users_email_address;
+
+ALTER TABLE users DROP COLUMN email;
@@ -0,0 +1,5 @@
+-- Up migration
+
+ALTER TABLE users ADD COLUMN email TEXT;
+
+CREATE UNIQUE INDEX idx_users_email_address ON users(email);
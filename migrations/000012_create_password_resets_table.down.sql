@@ -0,0 +1,5 @@
+-- Down migration
+
+DROP INDEX IF EXISTS idx_password_resets_user_id;
+
+DROP TABLE IF EXISTS password_resets;
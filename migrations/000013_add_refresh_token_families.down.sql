@@ -0,0 +1,7 @@
+-- Down migration
+
+DROP INDEX IF EXISTS idx_refresh_tokens_user_id;
+
+DROP INDEX IF EXISTS idx_refresh_tokens_family;
+
+ALTER TABLE refresh_tokens DROP COLUMN family;
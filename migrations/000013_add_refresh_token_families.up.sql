@@ -0,0 +1,9 @@
+-- Up migration
+
+-- Every login starts a family; the tokens a refresh token is rotated into
+-- share it, so presenting a rotated token again revokes the whole session.
+ALTER TABLE refresh_tokens ADD COLUMN family TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family);
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
@@ -0,0 +1,19 @@
+-- Up migration
+
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    -- The first characters of the key, to tell keys apart in the dashboard.
+    prefix TEXT NOT NULL,
+    -- SHA-256 of the key; the key itself is only shown when it's created.
+    key_hash TEXT NOT NULL UNIQUE,
+    -- Space separated, e.g. "forms:read submissions:read".
+    scopes TEXT NOT NULL,
+    expires_at TEXT,
+    last_used_at TEXT,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
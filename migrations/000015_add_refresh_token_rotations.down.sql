@@ -0,0 +1,5 @@
+-- Down migration
+
+ALTER TABLE refresh_tokens DROP COLUMN replaced_by;
+
+ALTER TABLE refresh_tokens DROP COLUMN rotated_at;
@@ -0,0 +1,7 @@
+-- Up migration
+
+-- A rotated token remembers when and into which token it was rotated, so
+-- concurrent refreshes presenting it right after can get the same successor.
+ALTER TABLE refresh_tokens ADD COLUMN rotated_at TIMESTAMP;
+
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by TEXT;
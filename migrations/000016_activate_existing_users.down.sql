@@ -0,0 +1,3 @@
+-- Down migration
+
+-- Nothing to undo: accounts activated since can't be told apart.
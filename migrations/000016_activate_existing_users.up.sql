@@ -0,0 +1,6 @@
+-- Up migration
+
+-- Accounts created before email verification were never activated, and have
+-- no email to verify, so they'd be locked out. Every registration since then
+-- has an email.
+UPDATE users SET is_active = 1 WHERE email IS NULL;
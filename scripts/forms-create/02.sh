@@ -0,0 +1,13 @@
+#! /bin/bash
+
+curl -X POST http://localhost:3000/form/create \
+  -d "user_id=1" \
+  -d "name=Contact with rules" \
+  -d "field_name=customer_type" \
+  -d "field_type=string" \
+  -d "field_constraints=[{\"constraint_name\": \"required\"},{\"constraint_name\": \"choices\", \"choices\": [\"personal\", \"business\"]}]" \
+  -d "field_rules=" \
+  -d "field_name=company" \
+  -d "field_type=string" \
+  -d "field_constraints=[]" \
+  -d "field_rules=[{\"effect\": \"show\", \"conditions\": [{\"field\": \"customer_type\", \"op\": \"eq\", \"value\": \"business\"}]},{\"effect\": \"require\", \"conditions\": [{\"field\": \"customer_type\", \"op\": \"eq\", \"value\": \"business\"}]}]"
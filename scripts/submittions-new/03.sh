@@ -0,0 +1,6 @@
+#! /bin/bash
+
+curl -X POST http://localhost:3000/api/submissions/new/1 \
+  -H "Content-Type: application/json" \
+  -H "Accept: application/json" \
+  -d '{"name": "Penpals", "email": "pen@pals.com", "subject": "Consulta", "message": "Hola!"}'